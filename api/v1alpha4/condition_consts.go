@@ -19,7 +19,7 @@ package v1alpha4
 import clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
 
 const (
-	// InstanceReadyCondition reports on current status of the EC2 instance. Ready indicates the instance is in a Running state.
+	// InstanceReadyCondition reports on current status of the hollow node. Ready indicates the hollow node pod has been created.
 	InstanceReadyCondition clusterv1.ConditionType = "InstanceReady"
 
 	// InstanceNotFoundReason used when the instance couldn't be retrieved.
@@ -38,4 +38,33 @@ const (
 	WaitingForClusterInfrastructureReason = "WaitingForClusterInfrastructure"
 	// WaitingForBootstrapDataReason used when machine is waiting for bootstrap data to be ready before proceeding.
 	WaitingForBootstrapDataReason = "WaitingForBootstrapData"
+	// WaitingForProvisioningDelayReason used when machine is held in provisioning by spec.provisioningDelay.
+	WaitingForProvisioningDelayReason = "WaitingForProvisioningDelay"
+	// WaitingForClientCertificateReason used when the Secret named by spec.clientCertificateSecretRef does not exist yet.
+	WaitingForClientCertificateReason = "WaitingForClientCertificate"
+	// WaitingForProvisionRateLimitReason used when machine is held in provisioning by the provision rate limit of the controller.
+	WaitingForProvisionRateLimitReason = "WaitingForProvisionRateLimit"
+)
+
+const (
+	// NodeReadyCondition mirrors the Ready condition of the workload cluster Node of the hollow node.
+	NodeReadyCondition clusterv1.ConditionType = "NodeReady"
+	// NodeHealthyCondition is false when the workload cluster Node of the hollow node reports
+	// memory, disk or PID pressure or an unavailable network.
+	NodeHealthyCondition clusterv1.ConditionType = "NodeHealthy"
+
+	// NodeNotFoundReason used when the Node of the hollow node is not registered in the workload cluster.
+	NodeNotFoundReason = "NodeNotFound"
+	// NodeNotReadyReason used when the Node of the hollow node is not ready.
+	NodeNotReadyReason = "NodeNotReady"
+	// NodeConditionsFailedReason used when the Node of the hollow node reports a pressure condition.
+	NodeConditionsFailedReason = "NodeConditionsFailed"
+)
+
+const (
+	// WorkloadClusterReachableCondition is false while the API server of the workload cluster of the machine cannot be reached.
+	WorkloadClusterReachableCondition clusterv1.ConditionType = "WorkloadClusterReachable"
+
+	// WorkloadClusterUnreachableReason used when requests to the workload cluster fail to connect or time out.
+	WorkloadClusterUnreachableReason = "WorkloadClusterUnreachable"
 )
@@ -0,0 +1,157 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha4
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// KillAnnotation marks a KubemarkMachine to be terminated like an
+	// interrupted instance. Its value names the chaos campaign that killed it.
+	KillAnnotation = "infrastructure.cluster.x-k8s.io/kubemark-kill"
+
+	// HeartbeatsStalledUntilAnnotation stops the heartbeats of the Node of a
+	// KubemarkMachine until the RFC 3339 time it holds, so that it turns
+	// NotReady.
+	HeartbeatsStalledUntilAnnotation = "infrastructure.cluster.x-k8s.io/kubemark-heartbeats-stalled-until"
+)
+
+// KubemarkChaosAction is a failure injected into simulated nodes.
+type KubemarkChaosAction string
+
+const (
+	// KubemarkChaosActionKill terminates machines like interrupted instances.
+	KubemarkChaosActionKill KubemarkChaosAction = "Kill"
+	// KubemarkChaosActionStallHeartbeats stops the heartbeats of the Nodes of
+	// machines for a while.
+	KubemarkChaosActionStallHeartbeats KubemarkChaosAction = "StallHeartbeats"
+	// KubemarkChaosActionPartitionZone stops the heartbeats of the Nodes of
+	// all machines in a failure domain for a while.
+	KubemarkChaosActionPartitionZone KubemarkChaosAction = "PartitionZone"
+)
+
+// KubemarkChaosScenario is a failure injected periodically.
+type KubemarkChaosScenario struct {
+	// Name identifies the scenario in the status of the campaign.
+	Name string `json:"name"`
+
+	// Action is the failure injected.
+	// +kubebuilder:validation:Enum=Kill;StallHeartbeats;PartitionZone
+	Action KubemarkChaosAction `json:"action"`
+
+	// Every is the time between two injections, the first one happening
+	// that long after the campaign is created.
+	Every metav1.Duration `json:"every"`
+
+	// Count is the number of machines affected by each injection of Kill
+	// and StallHeartbeats. Defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Count *int32 `json:"count,omitempty"`
+
+	// Duration is how long StallHeartbeats and PartitionZone stop the
+	// heartbeats.
+	// +optional
+	Duration *metav1.Duration `json:"duration,omitempty"`
+
+	// Zone is the failure domain PartitionZone partitions. If unset, each
+	// injection picks one of the failure domains of the selected machines.
+	// +optional
+	Zone string `json:"zone,omitempty"`
+}
+
+// KubemarkChaosCampaignSpec defines the failures injected into a fleet of
+// simulated nodes.
+type KubemarkChaosCampaignSpec struct {
+	// Selector selects the KubemarkMachines of the namespace the campaign
+	// injects failures into.
+	Selector metav1.LabelSelector `json:"selector"`
+
+	// Scenarios are the failures injected.
+	Scenarios []KubemarkChaosScenario `json:"scenarios"`
+}
+
+// KubemarkChaosEvent records an injected failure.
+type KubemarkChaosEvent struct {
+	// Time is when the failure was injected.
+	Time metav1.Time `json:"time"`
+
+	// Scenario is the name of the scenario that injected the failure.
+	Scenario string `json:"scenario"`
+
+	// Action is the failure injected.
+	Action KubemarkChaosAction `json:"action"`
+
+	// Zone is the failure domain that was partitioned, if any.
+	// +optional
+	Zone string `json:"zone,omitempty"`
+
+	// Machines are the names of the KubemarkMachines affected.
+	// +optional
+	Machines []string `json:"machines,omitempty"`
+}
+
+// KubemarkChaosScenarioStatus is the progress of a scenario.
+type KubemarkChaosScenarioStatus struct {
+	// Name is the name of the scenario.
+	Name string `json:"name"`
+
+	// LastInjectionTime is when the scenario last injected a failure.
+	// +optional
+	LastInjectionTime *metav1.Time `json:"lastInjectionTime,omitempty"`
+
+	// Injections is the number of times the scenario injected a failure.
+	// +optional
+	Injections int32 `json:"injections,omitempty"`
+}
+
+// KubemarkChaosCampaignStatus defines the observed state of KubemarkChaosCampaign
+type KubemarkChaosCampaignStatus struct {
+	// Scenarios is the progress of each scenario.
+	// +optional
+	Scenarios []KubemarkChaosScenarioStatus `json:"scenarios,omitempty"`
+
+	// Events are the most recent failures injected, oldest first.
+	// +optional
+	Events []KubemarkChaosEvent `json:"events,omitempty"`
+}
+
+// +kubebuilder:subresource:status
+// +kubebuilder:object:root=true
+
+// KubemarkChaosCampaign is the Schema for the kubemarkchaoscampaigns API
+type KubemarkChaosCampaign struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   KubemarkChaosCampaignSpec   `json:"spec,omitempty"`
+	Status KubemarkChaosCampaignStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// KubemarkChaosCampaignList contains a list of KubemarkChaosCampaign
+type KubemarkChaosCampaignList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KubemarkChaosCampaign `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KubemarkChaosCampaign{}, &KubemarkChaosCampaignList{})
+}
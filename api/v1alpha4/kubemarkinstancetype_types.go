@@ -0,0 +1,80 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha4
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// KubemarkInstanceTypeSpec defines the resources and labels of an instance type
+type KubemarkInstanceTypeSpec struct {
+	// CPU is the number of CPUs registered by hollow nodes of this type.
+	// +optional
+	CPU *resource.Quantity `json:"cpu,omitempty"`
+
+	// Memory is the amount of memory registered by hollow nodes of this type.
+	// +optional
+	Memory *resource.Quantity `json:"memory,omitempty"`
+
+	// GPU is the number of nvidia GPUs registered by hollow nodes of this type.
+	// +optional
+	GPU *resource.Quantity `json:"gpu,omitempty"`
+
+	// Labels are added to the hollow nodes of this type when they register.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:object:root=true
+
+// KubemarkInstanceType is the Schema for the kubemarkinstancetypes API
+type KubemarkInstanceType struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec KubemarkInstanceTypeSpec `json:"spec,omitempty"`
+}
+
+// ExtendedResources returns the resources registered by hollow nodes of this type.
+func (t *KubemarkInstanceType) ExtendedResources() KubemarkExtendedResourceList {
+	resources := KubemarkExtendedResourceList{}
+	if t.Spec.CPU != nil {
+		resources[KubemarkExtendedResourceCPU] = t.Spec.CPU.DeepCopy()
+	}
+	if t.Spec.Memory != nil {
+		resources[KubemarkExtendedResourceMemory] = t.Spec.Memory.DeepCopy()
+	}
+	if t.Spec.GPU != nil {
+		resources[KubemarkExtendedResourceGPU] = t.Spec.GPU.DeepCopy()
+	}
+	return resources
+}
+
+// +kubebuilder:object:root=true
+
+// KubemarkInstanceTypeList contains a list of KubemarkInstanceType
+type KubemarkInstanceTypeList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KubemarkInstanceType `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KubemarkInstanceType{}, &KubemarkInstanceTypeList{})
+}
@@ -17,18 +17,511 @@ limitations under the License.
 package v1alpha4
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+	capierrors "sigs.k8s.io/cluster-api/errors"
 )
 
 const (
 	// MachineFinalizer allows the controller to clean up resources associated with KubemarkMachine before
 	// removing it from the apiserver.
 	MachineFinalizer = "kubemarkmachine.infrastructure.cluster.x-k8s.io"
+
+	// OfflineAnnotation takes the Node of a KubemarkMachine offline for as
+	// long as it is set, like a Stopped power state, e.g. during game days.
+	OfflineAnnotation = "infrastructure.cluster.x-k8s.io/kubemark-offline"
 )
 
 // KubemarkMachineSpec defines the desired state of KubemarkMachine
 type KubemarkMachineSpec struct {
+	// ProviderID will be the provider ID of the Node, in the form
+	// kubemark://<machine-name> unless ProviderIDFormat says otherwise.
+	// +optional
+	ProviderID *string `json:"providerID,omitempty"`
+
+	// Backend is how the Node of the machine is simulated. The kubemark
+	// backend runs a hollow kubelet in a pod of the backing cluster. The kwok
+	// backend only registers a fake Node in the workload cluster, which a
+	// KWOK controller running there keeps alive; it is much lighter but has
+	// no kubelet fidelity. The node backend registers the Node and posts its
+	// heartbeats from the controller, with nothing running the pods bound
+	// to it. Defaults to kubemark.
+	// +kubebuilder:validation:Enum=kubemark;kwok;node
+	// +optional
+	Backend KubemarkBackend `json:"backend,omitempty"`
+
+	// Image is the kubemark image run by the hollow node, including its tag.
+	// It overrides the controller default, which is tagged with the Machine's
+	// Kubernetes version.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// ImagePullPolicy is the pull policy of the kubemark image. If unset, the
+	// backing cluster defaults it from the image tag.
+	// +kubebuilder:validation:Enum=Always;Never;IfNotPresent
+	// +optional
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+
+	// PodTemplate customizes the pod running the hollow node in the backing cluster.
+	// +optional
+	PodTemplate *KubemarkPodTemplate `json:"podTemplate,omitempty"`
+
+	// InstanceType is the name of the KubemarkInstanceType describing the
+	// resources and labels of the hollow node. Resources set in
+	// kubemarkOptions.extendedResources take precedence.
+	// +optional
+	InstanceType string `json:"instanceType,omitempty"`
+
+	// KubemarkOptions are options passed to the hollow kubelet process.
+	// +optional
+	KubemarkOptions KubemarkProcessOptions `json:"kubemarkOptions,omitempty"`
+
+	// ProvisioningDelay holds the machine in provisioning for the given
+	// duration after its creation before the hollow node is created. It
+	// simulates the time a cloud provider takes to bring up an instance.
+	// +optional
+	ProvisioningDelay *metav1.Duration `json:"provisioningDelay,omitempty"`
+
+	// Chaos configures failures injected into the hollow node.
+	// +optional
+	Chaos *KubemarkChaos `json:"chaos,omitempty"`
+
+	// KubeletConfig tunes how often the hollow kubelet writes to the API
+	// server and which of its feature gates are enabled.
+	// +optional
+	KubeletConfig *KubemarkKubeletConfig `json:"kubeletConfig,omitempty"`
+
+	// SecurityContext replaces the security context of the hollow node
+	// container. If unset, the container runs unprivileged as a non-root user.
+	// +optional
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+
+	// ClientCertificateSecretRef names a kubernetes.io/tls Secret in the
+	// namespace of the machine holding the client certificate and key the
+	// hollow kubelet authenticates with. If unset, the controller signs a
+	// certificate for the node with the cluster CA. A certificate for the
+	// system:node: identity must be issued for the name of the machine.
+	// +optional
+	ClientCertificateSecretRef *corev1.LocalObjectReference `json:"clientCertificateSecretRef,omitempty"`
+
+	// SharedClientCertificate has the hollow kubelets of the cluster share
+	// one client certificate, issued once instead of one per node, bound to
+	// the permissions of the kubelets by a ClusterRoleBinding of the workload
+	// cluster. This is less realistic: the Nodes lose their own identity, so
+	// the node authorizer and the NodeRestriction admission plugin do not
+	// restrict them. Only use it where per-node identity does not matter.
+	// +optional
+	SharedClientCertificate bool `json:"sharedClientCertificate,omitempty"`
+
+	// NodeInfo overrides the system information the Node reports. It is only
+	// supported by the kwok and node backends, a hollow kubelet reports the
+	// information of its fake runtime.
+	// +optional
+	NodeInfo *KubemarkNodeInfo `json:"nodeInfo,omitempty"`
+
+	// OSFamily is the operating system the Node pretends to run. A windows
+	// Node gets the Windows labels, the os=windows:NoSchedule taint and the
+	// system information of a Windows Server node. It is only supported by the
+	// kwok and node backends. Defaults to linux.
+	// +kubebuilder:validation:Enum=linux;windows
+	// +optional
+	OSFamily KubemarkOSFamily `json:"osFamily,omitempty"`
+
+	// Architecture is the CPU architecture of the Node. A hollow node runs the
+	// kubemark image built for it, on a backing cluster node of the same
+	// architecture. If unset, hollow nodes report the architecture of their
+	// image and other Nodes report amd64.
+	// +kubebuilder:validation:Enum=amd64;arm64
+	// +optional
+	Architecture KubemarkArchitecture `json:"architecture,omitempty"`
+
+	// ProviderIDFormat makes the Node masquerade as a cloud node by giving it
+	// a provider ID in that cloud's format. It is either the name of a preset,
+	// aws, azure or gce, or a template such as aws:///{{zone}}/{{id}}. The
+	// template may refer to {{name}}, the Node name, {{namespace}}, the
+	// namespace of the machine, {{zone}}, the failure domain of the Machine,
+	// and {{id}}, an instance ID derived from the machine. Defaults to
+	// kubemark://{{name}}.
+	// +optional
+	ProviderIDFormat KubemarkProviderIDFormat `json:"providerIDFormat,omitempty"`
+
+	// Interruption terminates the machine at a random time, like a spot or
+	// preemptible instance.
+	// +optional
+	Interruption *KubemarkInterruption `json:"interruption,omitempty"`
+
+	// NodeConditions are custom conditions the Node reports from its
+	// registration on, e.g. NetworkUnavailable or vendor conditions. They are
+	// only seeded: a condition the Node already reports is left alone, so
+	// that other controllers can change it afterwards.
+	// +optional
+	NodeConditions []KubemarkNodeCondition `json:"nodeConditions,omitempty"`
+
+	// PowerState stops and starts the machine like a cloud instance. A
+	// Stopped machine keeps its Node, which turns NotReady, but nothing
+	// simulates it until the machine is Running again. The kwok backend
+	// cannot be stopped. Defaults to Running.
+	// +kubebuilder:validation:Enum=Running;Stopped
+	// +optional
+	PowerState KubemarkPowerState `json:"powerState,omitempty"`
+
+	// VolumeAttachLimits are the number of volumes of in-tree plugins the
+	// Node can attach, registered as its attachable-volumes-<plugin> capacity
+	// for the volume limit checks of the scheduler.
+	// +optional
+	VolumeAttachLimits []KubemarkVolumeAttachLimit `json:"volumeAttachLimits,omitempty"`
+
+	// FakeCSIDriver registers a CSI driver on the Node: its CSINode lists the
+	// driver, with its attach limit and topology keys, so that the scheduler
+	// and the attach/detach controller treat the Node as running it. No
+	// driver actually runs.
+	// +optional
+	FakeCSIDriver *KubemarkFakeCSIDriver `json:"fakeCSIDriver,omitempty"`
+
+	// DevicePlugin emulates a device plugin on the Node: all its devices are
+	// registered as capacity, only the healthy ones as allocatable. Only the
+	// node backend supports it.
+	// +optional
+	DevicePlugin *KubemarkDevicePlugin `json:"devicePlugin,omitempty"`
+}
+
+// KubemarkNodeInfo is the system information reported by a simulated Node.
+// Unset fields keep their defaults.
+type KubemarkNodeInfo struct {
+	// OSImage is the operating system reported by the Node, e.g. "Ubuntu 20.04.1 LTS".
+	// +optional
+	OSImage string `json:"osImage,omitempty"`
+
+	// KernelVersion is the kernel version reported by the Node, e.g. "5.4.0-1029-aws".
+	// +optional
+	KernelVersion string `json:"kernelVersion,omitempty"`
+
+	// ContainerRuntimeVersion is the container runtime reported by the Node,
+	// e.g. "containerd://1.4.1".
+	// +optional
+	ContainerRuntimeVersion string `json:"containerRuntimeVersion,omitempty"`
+}
+
+// KubemarkBackend is the way the Node of a KubemarkMachine is simulated.
+type KubemarkBackend string
+
+const (
+	// KubemarkBackendKubemark runs a hollow kubelet in a pod of the backing cluster.
+	KubemarkBackendKubemark KubemarkBackend = "kubemark"
+	// KubemarkBackendKWOK registers a Node managed by KWOK in the workload cluster.
+	KubemarkBackendKWOK KubemarkBackend = "kwok"
+	// KubemarkBackendNode registers a Node heartbeated by the controller in the workload cluster.
+	KubemarkBackendNode KubemarkBackend = "node"
+)
+
+// KubemarkNodeCondition is a condition seeded on a simulated Node.
+type KubemarkNodeCondition struct {
+	// Type is the type of the condition, e.g. NetworkUnavailable.
+	Type corev1.NodeConditionType `json:"type"`
+
+	// Status is the status of the condition.
+	// +kubebuilder:validation:Enum=True;False;Unknown
+	Status corev1.ConditionStatus `json:"status"`
+
+	// Reason is a brief machine readable reason for the condition.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human readable description of the condition.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// KubemarkVolumePlugin is an in-tree volume plugin whose attachments the
+// scheduler limits per Node.
+type KubemarkVolumePlugin string
+
+const (
+	// KubemarkVolumePluginAWSEBS is the AWS Elastic Block Store plugin.
+	KubemarkVolumePluginAWSEBS KubemarkVolumePlugin = "aws-ebs"
+	// KubemarkVolumePluginGCEPD is the GCE Persistent Disk plugin.
+	KubemarkVolumePluginGCEPD KubemarkVolumePlugin = "gce-pd"
+	// KubemarkVolumePluginAzureDisk is the Azure Disk plugin.
+	KubemarkVolumePluginAzureDisk KubemarkVolumePlugin = "azure-disk"
+	// KubemarkVolumePluginCinder is the OpenStack Cinder plugin.
+	KubemarkVolumePluginCinder KubemarkVolumePlugin = "cinder"
+)
+
+// KubemarkAttachableVolumesPrefix prefixes the resources that hold the
+// attach limits of a Node.
+const KubemarkAttachableVolumesPrefix = "attachable-volumes-"
+
+// KubemarkVolumeAttachLimit is the number of volumes of a plugin a Node can
+// attach.
+type KubemarkVolumeAttachLimit struct {
+	// Plugin is the volume plugin the limit applies to.
+	// +kubebuilder:validation:Enum=aws-ebs;gce-pd;azure-disk;cinder
+	Plugin KubemarkVolumePlugin `json:"plugin"`
+
+	// Limit is the number of volumes of the plugin the Node can attach.
+	// +kubebuilder:validation:Minimum=0
+	Limit int32 `json:"limit"`
+}
+
+// ResourceName returns the resource a Node registers the limit as.
+func (l *KubemarkVolumeAttachLimit) ResourceName() KubemarkExtendedResourceName {
+	return KubemarkExtendedResourceName(KubemarkAttachableVolumesPrefix + string(l.Plugin))
+}
+
+// KubemarkFakeCSIDriver is a CSI driver a Node pretends to run.
+type KubemarkFakeCSIDriver struct {
+	// Name is the name of the driver, e.g. hostpath.csi.k8s.io.
+	Name string `json:"name"`
+
+	// MaxVolumes is the number of volumes of the driver the Node can attach.
+	// Unlimited if unset.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxVolumes *int32 `json:"maxVolumes,omitempty"`
+
+	// TopologyKeys are the keys of the Node labels the driver reports its
+	// topology with.
+	// +optional
+	TopologyKeys []string `json:"topologyKeys,omitempty"`
+}
+
+// KubemarkDevicePlugin describes the devices of an emulated device plugin.
+type KubemarkDevicePlugin struct {
+	// ResourceName is the extended resource of the devices. Defaults to
+	// nvidia.com/gpu.
+	// +optional
+	ResourceName KubemarkExtendedResourceName `json:"resourceName,omitempty"`
+
+	// Devices is the number of devices.
+	// +kubebuilder:validation:Minimum=0
+	Devices int32 `json:"devices"`
+
+	// Unhealthy turns some of the devices unhealthy.
+	// +optional
+	Unhealthy *KubemarkDeviceHealth `json:"unhealthy,omitempty"`
+}
+
+// KubemarkDeviceHealth describes devices reported unhealthy.
+type KubemarkDeviceHealth struct {
+	// Count is the number of devices unhealthy.
+	// +kubebuilder:validation:Minimum=1
+	Count int32 `json:"count"`
+
+	// Interval makes the devices unhealthy periodically: it is the time
+	// between the start of two unhealthy periods, counted from the moment the
+	// machine first became ready. If unset, the devices stay unhealthy as
+	// long as they are listed.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// Duration is how long the devices stay unhealthy each period. It must be
+	// set with Interval and be shorter than it.
+	// +optional
+	Duration *metav1.Duration `json:"duration,omitempty"`
+}
+
+// KubemarkPowerState is whether a machine is running.
+type KubemarkPowerState string
+
+const (
+	// KubemarkPowerStateRunning is a machine whose Node is simulated.
+	KubemarkPowerStateRunning KubemarkPowerState = "Running"
+	// KubemarkPowerStateStopped is a machine whose Node is left NotReady.
+	KubemarkPowerStateStopped KubemarkPowerState = "Stopped"
+)
+
+// KubemarkOSFamily is the operating system a simulated Node reports.
+type KubemarkOSFamily string
+
+const (
+	// KubemarkOSFamilyLinux is a Linux Node.
+	KubemarkOSFamilyLinux KubemarkOSFamily = "linux"
+	// KubemarkOSFamilyWindows is a Windows Server Node.
+	KubemarkOSFamilyWindows KubemarkOSFamily = "windows"
+)
+
+// KubemarkArchitecture is the CPU architecture a simulated Node reports.
+type KubemarkArchitecture string
+
+const (
+	// KubemarkArchitectureAMD64 is an x86-64 Node.
+	KubemarkArchitectureAMD64 KubemarkArchitecture = "amd64"
+	// KubemarkArchitectureARM64 is a 64-bit ARM Node.
+	KubemarkArchitectureARM64 KubemarkArchitecture = "arm64"
+)
+
+// KubemarkProviderIDFormat is a provider ID preset or template.
+type KubemarkProviderIDFormat string
+
+// providerIDPresets are the templates of the provider ID presets, in the
+// format of the respective cloud providers.
+var providerIDPresets = map[KubemarkProviderIDFormat]string{
+	"aws":   "aws:///{{zone}}/{{id}}",
+	"azure": "azure:///subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/{{namespace}}/providers/Microsoft.Compute/virtualMachines/{{name}}",
+	"gce":   "gce://{{namespace}}/{{zone}}/{{name}}",
+}
+
+// Template returns the provider ID template of the format, resolving presets.
+func (f KubemarkProviderIDFormat) Template() string {
+	if f == "" {
+		return "kubemark://{{name}}"
+	}
+	if template, ok := providerIDPresets[f]; ok {
+		return template
+	}
+	return string(f)
+}
+
+// KubemarkKubeletConfig holds the heartbeat settings and feature gates of a
+// hollow kubelet. Unset fields keep the defaults of the kubemark image.
+type KubemarkKubeletConfig struct {
+	// NodeStatusUpdateFrequency is how often the kubelet computes the node
+	// status and posts it when it changed.
+	// +optional
+	NodeStatusUpdateFrequency *metav1.Duration `json:"nodeStatusUpdateFrequency,omitempty"`
+
+	// NodeStatusReportFrequency is how often the kubelet posts the node status
+	// when it did not change.
+	// +optional
+	NodeStatusReportFrequency *metav1.Duration `json:"nodeStatusReportFrequency,omitempty"`
+
+	// NodeLeaseDurationSeconds is the duration of the node lease. The kubelet
+	// renews the lease every quarter of this duration.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	NodeLeaseDurationSeconds *int32 `json:"nodeLeaseDurationSeconds,omitempty"`
+
+	// FeatureGates enables or disables features of the hollow kubelet by
+	// name, e.g. to exercise alpha or beta features of the kubelet.
+	// +optional
+	FeatureGates map[string]bool `json:"featureGates,omitempty"`
+}
+
+// KubemarkChaos describes failures injected into a hollow node.
+type KubemarkChaos struct {
+	// ReadinessFlap periodically stops the hollow node so that it turns NotReady.
+	// +optional
+	ReadinessFlap *KubemarkReadinessFlap `json:"readinessFlap,omitempty"`
+
+	// Pressure turns pressure conditions of the Node true, for as long as
+	// they are listed or periodically. It is only supported by the node
+	// backend, a hollow kubelet or KWOK report their own pressure.
+	// +optional
+	Pressure []KubemarkPressure `json:"pressure,omitempty"`
+}
+
+// KubemarkReadinessFlap describes a periodic downtime of a hollow node.
+type KubemarkReadinessFlap struct {
+	// Interval is the time between the start of two downtimes, counted from
+	// the moment the machine first became ready.
+	Interval metav1.Duration `json:"interval"`
+
+	// Downtime is how long the hollow node is stopped in each interval. It
+	// must be shorter than the interval.
+	Downtime metav1.Duration `json:"downtime"`
+}
+
+// KubemarkInterruption describes the random termination of a machine.
+type KubemarkInterruption struct {
+	// MeanTimeBetween is the mean time from the machine becoming ready until
+	// it is interrupted. The time of each machine is drawn from an exponential
+	// distribution, so interruptions are spread like independent failures.
+	MeanTimeBetween metav1.Duration `json:"meanTimeBetween"`
+
+	// Notice is how long before the interruption the Node reports the
+	// InterruptionNotice condition, if set.
+	// +optional
+	Notice *metav1.Duration `json:"notice,omitempty"`
+}
+
+// KubemarkPressure describes a pressure condition reported by a Node.
+type KubemarkPressure struct {
+	// Condition is the pressure condition turned true.
+	// +kubebuilder:validation:Enum=MemoryPressure;DiskPressure;PIDPressure
+	Condition corev1.NodeConditionType `json:"condition"`
+
+	// Interval makes the pressure periodic: it is the time between the start
+	// of two pressure periods, counted from the moment the machine first
+	// became ready. If unset, the pressure lasts as long as it is listed.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// Duration is how long each periodic pressure lasts. It must be set with
+	// Interval and be shorter than it.
+	// +optional
+	Duration *metav1.Duration `json:"duration,omitempty"`
+}
+
+// KubemarkProcessOptions describes the options passed to the hollow kubelet process.
+type KubemarkProcessOptions struct {
+	// ExtendedResources is a map of resource names and quantities that the
+	// hollow node registers as its capacity. Names are cpu, memory,
+	// ephemeral-storage, hugepages-<size>, attachable-volumes-<plugin> or a
+	// domain-prefixed extended resource such as nvidia.com/gpu. Huge page
+	// quantities must be a multiple of the page size.
+	// +optional
+	ExtendedResources KubemarkExtendedResourceList `json:"extendedResources,omitempty"`
+}
+
+// KubemarkExtendedResourceName is the name of a resource registered by a hollow node.
+type KubemarkExtendedResourceName string
+
+const (
+	// KubemarkExtendedResourceCPU is the number of CPUs registered by the hollow node.
+	KubemarkExtendedResourceCPU KubemarkExtendedResourceName = "cpu"
+	// KubemarkExtendedResourceMemory is the amount of memory registered by the hollow node.
+	KubemarkExtendedResourceMemory KubemarkExtendedResourceName = "memory"
+	// KubemarkExtendedResourceGPU is the number of nvidia GPUs registered by the hollow node.
+	KubemarkExtendedResourceGPU KubemarkExtendedResourceName = "nvidia.com/gpu"
+	// KubemarkExtendedResourceEphemeralStorage is the amount of local ephemeral storage registered by the hollow node.
+	KubemarkExtendedResourceEphemeralStorage KubemarkExtendedResourceName = "ephemeral-storage"
+	// KubemarkExtendedResourceHugePages2Mi is the amount of memory in 2Mi huge pages registered by the hollow node.
+	KubemarkExtendedResourceHugePages2Mi KubemarkExtendedResourceName = "hugepages-2Mi"
+	// KubemarkExtendedResourceHugePages1Gi is the amount of memory in 1Gi huge pages registered by the hollow node.
+	KubemarkExtendedResourceHugePages1Gi KubemarkExtendedResourceName = "hugepages-1Gi"
+)
+
+// KubemarkExtendedResourceList is a set of resource names and quantities.
+type KubemarkExtendedResourceList map[KubemarkExtendedResourceName]resource.Quantity
+
+// KubemarkPodTemplate describes the customizations applied to the hollow node pod.
+type KubemarkPodTemplate struct {
+	// SchedulerName is the name of the scheduler that places the hollow node pod.
+	// If empty, the default scheduler of the backing cluster is used.
+	// +optional
+	SchedulerName string `json:"schedulerName,omitempty"`
+
+	// TopologySpreadConstraints describe how hollow node pods are spread
+	// across the topology domains of the backing cluster. Constraints without
+	// a label selector select all hollow node pods.
+	// +optional
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+
+	// SpreadAcrossNodes adds a preferred pod anti-affinity between hollow node
+	// pods so the scheduler avoids placing them on the same backing node.
+	// +optional
+	SpreadAcrossNodes bool `json:"spreadAcrossNodes,omitempty"`
+
+	// ExposeKubelet declares the port the hollow kubelet serves its API on as
+	// a container port of the pod. The Node registers the pod IP as its
+	// internal address, so components dialing the kubelet, such as
+	// metrics-server, reach it if the pod network of the backing cluster is
+	// routable from where they run.
+	// +optional
+	ExposeKubelet bool `json:"exposeKubelet,omitempty"`
+
+	// Overlay is a partial PodTemplateSpec merged into the generated hollow
+	// node pod with strategic merge patch semantics, after all other fields
+	// of the machine spec have been applied. It allows tweaking anything the
+	// API has no dedicated field for, such as environment variables, volumes
+	// or sidecar containers. Containers merge by name; the hollow node
+	// container is named "hollow-node".
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	Overlay *runtime.RawExtension `json:"overlay,omitempty"`
 }
 
 // KubemarkMachineStatus defines the observed state of KubemarkMachine
@@ -37,6 +530,20 @@ type KubemarkMachineStatus struct {
 	// +optional
 	Ready bool `json:"ready"`
 
+	// ProvisioningDuration is the time it took from the creation of the
+	// machine until it first became ready.
+	// +optional
+	ProvisioningDuration *metav1.Duration `json:"provisioningDuration,omitempty"`
+
+	// FailureReason is set when the machine failed terminally, e.g. when it
+	// was interrupted, for the Machine controller to pick it up.
+	// +optional
+	FailureReason *capierrors.MachineStatusError `json:"failureReason,omitempty"`
+
+	// FailureMessage is a human readable description of FailureReason.
+	// +optional
+	FailureMessage *string `json:"failureMessage,omitempty"`
+
 	// Conditions defines current service state of the DockerMachine.
 	// +optional
 	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
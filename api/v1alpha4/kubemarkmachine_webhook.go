@@ -0,0 +1,251 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha4
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+func (m *KubemarkMachine) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(m).
+		Complete()
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-infrastructure-cluster-x-k8s-io-v1alpha4-kubemarkmachine,mutating=false,failurePolicy=fail,matchPolicy=Equivalent,groups=infrastructure.cluster.x-k8s.io,resources=kubemarkmachines,versions=v1alpha4,name=validation.kubemarkmachine.infrastructure.cluster.x-k8s.io,sideEffects=None,admissionReviewVersions=v1beta1
+
+var _ webhook.Validator = &KubemarkMachine{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (m *KubemarkMachine) ValidateCreate() error {
+	return m.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (m *KubemarkMachine) ValidateUpdate(old runtime.Object) error {
+	return m.validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (m *KubemarkMachine) ValidateDelete() error {
+	return nil
+}
+
+func (m *KubemarkMachine) validate() error {
+	allErrs := m.Spec.validate(field.NewPath("spec"))
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("KubemarkMachine").GroupKind(), m.Name, allErrs)
+}
+
+func (s *KubemarkMachineSpec) validate(fldPath *field.Path) field.ErrorList {
+	allErrs := s.KubemarkOptions.ExtendedResources.Validate(fldPath.Child("kubemarkOptions", "extendedResources"))
+	allErrs = append(allErrs, s.ProviderIDFormat.Validate(fldPath.Child("providerIDFormat"))...)
+	if s.Chaos != nil && s.Chaos.ReadinessFlap != nil {
+		path := fldPath.Child("chaos", "readinessFlap")
+		flap := s.Chaos.ReadinessFlap
+		if flap.Interval.Duration <= 0 {
+			allErrs = append(allErrs, field.Invalid(path.Child("interval"), flap.Interval.Duration.String(), "must be positive"))
+		}
+		if flap.Downtime.Duration <= 0 || flap.Downtime.Duration >= flap.Interval.Duration {
+			allErrs = append(allErrs, field.Invalid(path.Child("downtime"), flap.Downtime.Duration.String(),
+				"must be positive and shorter than the interval"))
+		}
+	}
+	if s.Chaos != nil && len(s.Chaos.Pressure) > 0 {
+		path := fldPath.Child("chaos", "pressure")
+		if s.Backend != KubemarkBackendNode {
+			allErrs = append(allErrs, field.Forbidden(path, "is only supported by the node backend"))
+		}
+		for i, pressure := range s.Chaos.Pressure {
+			if (pressure.Interval == nil) != (pressure.Duration == nil) {
+				allErrs = append(allErrs, field.Required(path.Index(i), "interval and duration must be set together"))
+				continue
+			}
+			if pressure.Interval != nil && (pressure.Duration.Duration <= 0 || pressure.Duration.Duration >= pressure.Interval.Duration) {
+				allErrs = append(allErrs, field.Invalid(path.Index(i).Child("duration"), pressure.Duration.Duration.String(),
+					"must be positive and shorter than the interval"))
+			}
+		}
+	}
+	if s.PowerState == KubemarkPowerStateStopped && s.Backend == KubemarkBackendKWOK {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("powerState"), "KWOK keeps its nodes running"))
+	}
+	seen := map[corev1.NodeConditionType]bool{}
+	for i, condition := range s.NodeConditions {
+		path := fldPath.Child("nodeConditions").Index(i).Child("type")
+		switch {
+		case condition.Type == corev1.NodeReady:
+			allErrs = append(allErrs, field.Forbidden(path, "the Ready condition is reported by the Node itself"))
+		case seen[condition.Type]:
+			allErrs = append(allErrs, field.Duplicate(path, condition.Type))
+		}
+		seen[condition.Type] = true
+	}
+	plugins := map[KubemarkVolumePlugin]bool{}
+	for i, limit := range s.VolumeAttachLimits {
+		if plugins[limit.Plugin] {
+			allErrs = append(allErrs, field.Duplicate(fldPath.Child("volumeAttachLimits").Index(i).Child("plugin"), limit.Plugin))
+		}
+		plugins[limit.Plugin] = true
+	}
+	if plugin := s.DevicePlugin; plugin != nil {
+		path := fldPath.Child("devicePlugin")
+		if s.Backend != KubemarkBackendNode {
+			allErrs = append(allErrs, field.Forbidden(path, "is only supported by the node backend"))
+		}
+		if name := plugin.ResourceName; name != "" && !strings.Contains(string(name), "/") {
+			allErrs = append(allErrs, field.Invalid(path.Child("resourceName"), name, "must be a domain-prefixed extended resource"))
+		}
+		if unhealthy := plugin.Unhealthy; unhealthy != nil {
+			if unhealthy.Count > plugin.Devices {
+				allErrs = append(allErrs, field.Invalid(path.Child("unhealthy", "count"), unhealthy.Count, "must not exceed the number of devices"))
+			}
+			if (unhealthy.Interval == nil) != (unhealthy.Duration == nil) {
+				allErrs = append(allErrs, field.Required(path.Child("unhealthy"), "interval and duration must be set together"))
+			} else if unhealthy.Interval != nil && (unhealthy.Duration.Duration <= 0 || unhealthy.Duration.Duration >= unhealthy.Interval.Duration) {
+				allErrs = append(allErrs, field.Invalid(path.Child("unhealthy", "duration"), unhealthy.Duration.Duration.String(),
+					"must be positive and shorter than the interval"))
+			}
+		}
+	}
+	if interruption := s.Interruption; interruption != nil {
+		if interruption.MeanTimeBetween.Duration <= 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("interruption", "meanTimeBetween"),
+				interruption.MeanTimeBetween.Duration.String(), "must be positive"))
+		}
+		if interruption.Notice != nil && interruption.Notice.Duration < 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("interruption", "notice"),
+				interruption.Notice.Duration.String(), "must not be negative"))
+		}
+	}
+	if s.SharedClientCertificate {
+		path := fldPath.Child("sharedClientCertificate")
+		if s.ClientCertificateSecretRef != nil {
+			allErrs = append(allErrs, field.Forbidden(path, "cannot be set with clientCertificateSecretRef"))
+		}
+		if s.Backend != "" && s.Backend != KubemarkBackendKubemark {
+			allErrs = append(allErrs, field.Forbidden(path, "is only supported by the kubemark backend"))
+		}
+	}
+	if s.Backend == "" || s.Backend == KubemarkBackendKubemark {
+		if s.NodeInfo != nil {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("nodeInfo"), "is only supported by the kwok and node backends"))
+		}
+		if s.OSFamily == KubemarkOSFamilyWindows {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("osFamily"), "windows is only supported by the kwok and node backends"))
+		}
+	}
+	return allErrs
+}
+
+// providerIDPlaceholder matches the placeholders of a provider ID template.
+var providerIDPlaceholder = regexp.MustCompile(`{{[^}]*}}`)
+
+// Validate checks that the format is a preset or a template with a scheme,
+// only known placeholders, and the Node name or instance ID to keep provider
+// IDs unique.
+func (f KubemarkProviderIDFormat) Validate(fldPath *field.Path) field.ErrorList {
+	if f == "" {
+		return nil
+	}
+	var allErrs field.ErrorList
+	template := f.Template()
+	if !strings.Contains(template, "://") {
+		allErrs = append(allErrs, field.Invalid(fldPath, string(f), "must be one of aws, azure, gce or a template of the form <scheme>://..."))
+	}
+	unique := false
+	for _, placeholder := range providerIDPlaceholder.FindAllString(template, -1) {
+		switch placeholder {
+		case "{{name}}", "{{id}}":
+			unique = true
+		case "{{namespace}}", "{{zone}}":
+		default:
+			allErrs = append(allErrs, field.Invalid(fldPath, string(f),
+				fmt.Sprintf("unknown placeholder %s, must be one of {{name}}, {{namespace}}, {{zone}}, {{id}}", placeholder)))
+		}
+	}
+	if !unique {
+		allErrs = append(allErrs, field.Invalid(fldPath, string(f), "must contain {{name}} or {{id}}"))
+	}
+	return allErrs
+}
+
+// Validate checks that the resources can be registered by a hollow node: the
+// names are ones the hollow kubelet understands and the quantities are not
+// negative.
+func (l KubemarkExtendedResourceList) Validate(fldPath *field.Path) field.ErrorList {
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	var allErrs field.ErrorList
+	for _, name := range names {
+		quantity := l[KubemarkExtendedResourceName(name)]
+		if quantity.Sign() < 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Key(name), quantity.String(), "must not be negative"))
+		}
+		switch {
+		case name == string(KubemarkExtendedResourceCPU),
+			name == string(KubemarkExtendedResourceMemory),
+			name == string(KubemarkExtendedResourceEphemeralStorage):
+		case strings.HasPrefix(name, corev1.ResourceHugePagesPrefix):
+			pageSize, err := resource.ParseQuantity(strings.TrimPrefix(name, corev1.ResourceHugePagesPrefix))
+			if err != nil || pageSize.Sign() <= 0 {
+				allErrs = append(allErrs, field.Invalid(fldPath.Key(name), name, "invalid huge page size"))
+				continue
+			}
+			if quantity.Value()%pageSize.Value() != 0 {
+				allErrs = append(allErrs, field.Invalid(fldPath.Key(name), quantity.String(),
+					fmt.Sprintf("must be a multiple of the page size %s", pageSize.String())))
+			}
+		case strings.HasPrefix(name, KubemarkAttachableVolumesPrefix):
+			if quantity.MilliValue()%1000 != 0 {
+				allErrs = append(allErrs, field.Invalid(fldPath.Key(name), quantity.String(), "must be a whole number of volumes"))
+			}
+		case strings.Contains(name, "/"):
+			if errs := validation.IsQualifiedName(name); len(errs) > 0 {
+				allErrs = append(allErrs, field.Invalid(fldPath.Key(name), name, strings.Join(errs, "; ")))
+			}
+		default:
+			allErrs = append(allErrs, field.NotSupported(fldPath.Key(name), name, []string{
+				string(KubemarkExtendedResourceCPU),
+				string(KubemarkExtendedResourceMemory),
+				string(KubemarkExtendedResourceEphemeralStorage),
+				corev1.ResourceHugePagesPrefix + "<size>",
+				KubemarkAttachableVolumesPrefix + "<plugin>",
+				"<domain>/<name>",
+			}))
+		}
+	}
+	return allErrs
+}
@@ -17,7 +17,9 @@ limitations under the License.
 package v1alpha4
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -26,8 +28,38 @@ import (
 // KubemarkMachineTemplateSpec defines the desired state of KubemarkMachineTemplate
 type KubemarkMachineTemplateSpec struct {
 	Template KubemarkMachineTemplateResource `json:"template"`
+
+	// PodDisruptionBudget protects the hollow node pods of the machines
+	// created from this template from voluntary disruptions in the backing
+	// cluster, such as node drains.
+	// +optional
+	PodDisruptionBudget *KubemarkPodDisruptionBudget `json:"podDisruptionBudget,omitempty"`
+}
+
+// KubemarkPodDisruptionBudget describes the disruption budget of hollow node
+// pods. Only one of MinAvailable and MaxUnavailable may be set.
+type KubemarkPodDisruptionBudget struct {
+	// MinAvailable is the number or percentage of hollow node pods that must
+	// remain available during an eviction.
+	// +optional
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+
+	// MaxUnavailable is the number or percentage of hollow node pods that may
+	// be unavailable after an eviction.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// KubemarkMachineTemplateStatus defines the observed state of KubemarkMachineTemplate
+type KubemarkMachineTemplateStatus struct {
+	// Capacity defines the resource capacity of the machines created from
+	// this template. It is used by the cluster autoscaler to scale node
+	// groups from zero.
+	// +optional
+	Capacity corev1.ResourceList `json:"capacity,omitempty"`
 }
 
+// +kubebuilder:subresource:status
 // +kubebuilder:object:root=true
 
 // KubemarkMachineTemplate is the Schema for the kubemarkmachinetemplates API
@@ -35,7 +67,8 @@ type KubemarkMachineTemplate struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec KubemarkMachineTemplateSpec `json:"spec,omitempty"`
+	Spec   KubemarkMachineTemplateSpec   `json:"spec,omitempty"`
+	Status KubemarkMachineTemplateStatus `json:"status,omitempty"`
 }
 
 // +kubebuilder:object:root=true
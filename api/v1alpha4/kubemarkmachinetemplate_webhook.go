@@ -0,0 +1,78 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha4
+
+import (
+	"fmt"
+	"reflect"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+func (m *KubemarkMachineTemplate) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(m).
+		Complete()
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-infrastructure-cluster-x-k8s-io-v1alpha4-kubemarkmachinetemplate,mutating=false,failurePolicy=fail,matchPolicy=Equivalent,groups=infrastructure.cluster.x-k8s.io,resources=kubemarkmachinetemplates,versions=v1alpha4,name=validation.kubemarkmachinetemplate.infrastructure.cluster.x-k8s.io,sideEffects=None,admissionReviewVersions=v1beta1
+
+var _ webhook.Validator = &KubemarkMachineTemplate{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (m *KubemarkMachineTemplate) ValidateCreate() error {
+	return m.validate(nil)
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (m *KubemarkMachineTemplate) ValidateUpdate(old runtime.Object) error {
+	oldTemplate, ok := old.(*KubemarkMachineTemplate)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a KubemarkMachineTemplate but got a %T", old))
+	}
+	return m.validate(oldTemplate)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (m *KubemarkMachineTemplate) ValidateDelete() error {
+	return nil
+}
+
+// validate checks the template spec and disruption budget and, on update,
+// that spec.template is unchanged. Machines are cloned from the template when
+// they are created, so changing it would leave existing machines behind; a
+// new template has to be rolled out instead. Metadata and the disruption
+// budget may still change.
+func (m *KubemarkMachineTemplate) validate(old *KubemarkMachineTemplate) error {
+	allErrs := m.Spec.Template.Spec.validate(field.NewPath("spec", "template", "spec"))
+	if budget := m.Spec.PodDisruptionBudget; budget != nil && budget.MinAvailable != nil && budget.MaxUnavailable != nil {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "podDisruptionBudget", "maxUnavailable"),
+			"only one of minAvailable and maxUnavailable may be set"))
+	}
+	if old != nil && !reflect.DeepEqual(m.Spec.Template, old.Spec.Template) {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "template"),
+			"KubemarkMachineTemplate spec.template is immutable, create a new template instead"))
+	}
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("KubemarkMachineTemplate").GroupKind(), m.Name, allErrs)
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha4
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// WorkloadFinalizer allows ReconcileKubemarkWorkload to remove the pods
+	// of a KubemarkWorkload from the workload cluster before it is deleted.
+	WorkloadFinalizer = "kubemarkworkload.infrastructure.cluster.x-k8s.io"
+
+	// WorkloadLabel is set on the pods of a KubemarkWorkload to the name of
+	// the workload.
+	WorkloadLabel = "infrastructure.cluster.x-k8s.io/kubemark-workload"
+)
+
+// KubemarkWorkloadPodSize is a kind of pod created by a workload.
+type KubemarkWorkloadPodSize struct {
+	// Name identifies the size in the pod labels.
+	Name string `json:"name"`
+
+	// Weight is the share of the pods created with this size, relative to
+	// the weights of the other sizes. Defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Weight *int32 `json:"weight,omitempty"`
+
+	// Requests are the resources requested by the pods of this size.
+	// +optional
+	Requests corev1.ResourceList `json:"requests,omitempty"`
+}
+
+// KubemarkWorkloadSpec defines the pods churned in a workload cluster.
+type KubemarkWorkloadSpec struct {
+	// ClusterName is the name of the Cluster of the namespace the pods are
+	// created in.
+	ClusterName string `json:"clusterName"`
+
+	// Namespace is the namespace of the workload cluster the pods are created
+	// in. Defaults to "default".
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// PodsPerMinute is the rate at which pods are created.
+	// +kubebuilder:validation:Minimum=1
+	PodsPerMinute int32 `json:"podsPerMinute"`
+
+	// Lifetime is how long a pod lives before it is deleted.
+	Lifetime metav1.Duration `json:"lifetime"`
+
+	// MaxPods is the number of pods of the workload that may exist at once.
+	// Creation pauses while it is reached. Unlimited if unset.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxPods *int32 `json:"maxPods,omitempty"`
+
+	// Sizes are the kinds of pods created, picked at random by weight. If
+	// empty, the pods request no resources.
+	// +optional
+	Sizes []KubemarkWorkloadPodSize `json:"sizes,omitempty"`
+
+	// NodeSelector constrains the pods to Nodes with these labels, e.g. to
+	// the simulated nodes of the cluster.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Image is the image of the pods. Defaults to the pause image.
+	// +optional
+	Image string `json:"image,omitempty"`
+}
+
+// KubemarkWorkloadStatus defines the observed state of KubemarkWorkload
+type KubemarkWorkloadStatus struct {
+	// Pods is the number of pods of the workload in the workload cluster.
+	// +optional
+	Pods int32 `json:"pods,omitempty"`
+
+	// Created is the number of pods the workload created.
+	// +optional
+	Created int64 `json:"created,omitempty"`
+
+	// Deleted is the number of pods the workload deleted at the end of their
+	// lifetime.
+	// +optional
+	Deleted int64 `json:"deleted,omitempty"`
+
+	// LastCreationTime is when pods of the workload were last due for
+	// creation.
+	// +optional
+	LastCreationTime *metav1.Time `json:"lastCreationTime,omitempty"`
+}
+
+// +kubebuilder:subresource:status
+// +kubebuilder:object:root=true
+
+// KubemarkWorkload is the Schema for the kubemarkworkloads API
+type KubemarkWorkload struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   KubemarkWorkloadSpec   `json:"spec,omitempty"`
+	Status KubemarkWorkloadStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// KubemarkWorkloadList contains a list of KubemarkWorkload
+type KubemarkWorkloadList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KubemarkWorkload `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KubemarkWorkload{}, &KubemarkWorkloadList{})
+}
@@ -21,16 +21,468 @@ limitations under the License.
 package v1alpha4
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	apiv1alpha4 "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/cluster-api/errors"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkChaos) DeepCopyInto(out *KubemarkChaos) {
+	*out = *in
+	if in.ReadinessFlap != nil {
+		in, out := &in.ReadinessFlap, &out.ReadinessFlap
+		*out = new(KubemarkReadinessFlap)
+		**out = **in
+	}
+	if in.Pressure != nil {
+		in, out := &in.Pressure, &out.Pressure
+		*out = make([]KubemarkPressure, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkChaos.
+func (in *KubemarkChaos) DeepCopy() *KubemarkChaos {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkChaos)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkChaosCampaign) DeepCopyInto(out *KubemarkChaosCampaign) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkChaosCampaign.
+func (in *KubemarkChaosCampaign) DeepCopy() *KubemarkChaosCampaign {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkChaosCampaign)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KubemarkChaosCampaign) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkChaosCampaignList) DeepCopyInto(out *KubemarkChaosCampaignList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]KubemarkChaosCampaign, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkChaosCampaignList.
+func (in *KubemarkChaosCampaignList) DeepCopy() *KubemarkChaosCampaignList {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkChaosCampaignList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KubemarkChaosCampaignList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkChaosCampaignSpec) DeepCopyInto(out *KubemarkChaosCampaignSpec) {
+	*out = *in
+	in.Selector.DeepCopyInto(&out.Selector)
+	if in.Scenarios != nil {
+		in, out := &in.Scenarios, &out.Scenarios
+		*out = make([]KubemarkChaosScenario, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkChaosCampaignSpec.
+func (in *KubemarkChaosCampaignSpec) DeepCopy() *KubemarkChaosCampaignSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkChaosCampaignSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkChaosCampaignStatus) DeepCopyInto(out *KubemarkChaosCampaignStatus) {
+	*out = *in
+	if in.Scenarios != nil {
+		in, out := &in.Scenarios, &out.Scenarios
+		*out = make([]KubemarkChaosScenarioStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Events != nil {
+		in, out := &in.Events, &out.Events
+		*out = make([]KubemarkChaosEvent, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkChaosCampaignStatus.
+func (in *KubemarkChaosCampaignStatus) DeepCopy() *KubemarkChaosCampaignStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkChaosCampaignStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkChaosEvent) DeepCopyInto(out *KubemarkChaosEvent) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	if in.Machines != nil {
+		in, out := &in.Machines, &out.Machines
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkChaosEvent.
+func (in *KubemarkChaosEvent) DeepCopy() *KubemarkChaosEvent {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkChaosEvent)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkChaosScenario) DeepCopyInto(out *KubemarkChaosScenario) {
+	*out = *in
+	out.Every = in.Every
+	if in.Count != nil {
+		in, out := &in.Count, &out.Count
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Duration != nil {
+		in, out := &in.Duration, &out.Duration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkChaosScenario.
+func (in *KubemarkChaosScenario) DeepCopy() *KubemarkChaosScenario {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkChaosScenario)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkChaosScenarioStatus) DeepCopyInto(out *KubemarkChaosScenarioStatus) {
+	*out = *in
+	if in.LastInjectionTime != nil {
+		in, out := &in.LastInjectionTime, &out.LastInjectionTime
+		*out = new(v1.Time)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkChaosScenarioStatus.
+func (in *KubemarkChaosScenarioStatus) DeepCopy() *KubemarkChaosScenarioStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkChaosScenarioStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkDeviceHealth) DeepCopyInto(out *KubemarkDeviceHealth) {
+	*out = *in
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Duration != nil {
+		in, out := &in.Duration, &out.Duration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkDeviceHealth.
+func (in *KubemarkDeviceHealth) DeepCopy() *KubemarkDeviceHealth {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkDeviceHealth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkDevicePlugin) DeepCopyInto(out *KubemarkDevicePlugin) {
+	*out = *in
+	if in.Unhealthy != nil {
+		in, out := &in.Unhealthy, &out.Unhealthy
+		*out = new(KubemarkDeviceHealth)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkDevicePlugin.
+func (in *KubemarkDevicePlugin) DeepCopy() *KubemarkDevicePlugin {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkDevicePlugin)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in KubemarkExtendedResourceList) DeepCopyInto(out *KubemarkExtendedResourceList) {
+	{
+		in := &in
+		*out = make(KubemarkExtendedResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkExtendedResourceList.
+func (in KubemarkExtendedResourceList) DeepCopy() KubemarkExtendedResourceList {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkExtendedResourceList)
+	in.DeepCopyInto(out)
+	return *out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkFakeCSIDriver) DeepCopyInto(out *KubemarkFakeCSIDriver) {
+	*out = *in
+	if in.MaxVolumes != nil {
+		in, out := &in.MaxVolumes, &out.MaxVolumes
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TopologyKeys != nil {
+		in, out := &in.TopologyKeys, &out.TopologyKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkFakeCSIDriver.
+func (in *KubemarkFakeCSIDriver) DeepCopy() *KubemarkFakeCSIDriver {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkFakeCSIDriver)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkInstanceType) DeepCopyInto(out *KubemarkInstanceType) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkInstanceType.
+func (in *KubemarkInstanceType) DeepCopy() *KubemarkInstanceType {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkInstanceType)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KubemarkInstanceType) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkInstanceTypeList) DeepCopyInto(out *KubemarkInstanceTypeList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]KubemarkInstanceType, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkInstanceTypeList.
+func (in *KubemarkInstanceTypeList) DeepCopy() *KubemarkInstanceTypeList {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkInstanceTypeList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KubemarkInstanceTypeList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkInstanceTypeSpec) DeepCopyInto(out *KubemarkInstanceTypeSpec) {
+	*out = *in
+	if in.CPU != nil {
+		in, out := &in.CPU, &out.CPU
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Memory != nil {
+		in, out := &in.Memory, &out.Memory
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.GPU != nil {
+		in, out := &in.GPU, &out.GPU
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkInstanceTypeSpec.
+func (in *KubemarkInstanceTypeSpec) DeepCopy() *KubemarkInstanceTypeSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkInstanceTypeSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkInterruption) DeepCopyInto(out *KubemarkInterruption) {
+	*out = *in
+	if in.Notice != nil {
+		in, out := &in.Notice, &out.Notice
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkInterruption.
+func (in *KubemarkInterruption) DeepCopy() *KubemarkInterruption {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkInterruption)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkKubeletConfig) DeepCopyInto(out *KubemarkKubeletConfig) {
+	*out = *in
+	if in.NodeStatusUpdateFrequency != nil {
+		in, out := &in.NodeStatusUpdateFrequency, &out.NodeStatusUpdateFrequency
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.NodeStatusReportFrequency != nil {
+		in, out := &in.NodeStatusReportFrequency, &out.NodeStatusReportFrequency
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.NodeLeaseDurationSeconds != nil {
+		in, out := &in.NodeLeaseDurationSeconds, &out.NodeLeaseDurationSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.FeatureGates != nil {
+		in, out := &in.FeatureGates, &out.FeatureGates
+		*out = make(map[string]bool, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkKubeletConfig.
+func (in *KubemarkKubeletConfig) DeepCopy() *KubemarkKubeletConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkKubeletConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KubemarkMachine) DeepCopyInto(out *KubemarkMachine) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -87,6 +539,72 @@ func (in *KubemarkMachineList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KubemarkMachineSpec) DeepCopyInto(out *KubemarkMachineSpec) {
 	*out = *in
+	if in.ProviderID != nil {
+		in, out := &in.ProviderID, &out.ProviderID
+		*out = new(string)
+		**out = **in
+	}
+	if in.PodTemplate != nil {
+		in, out := &in.PodTemplate, &out.PodTemplate
+		*out = new(KubemarkPodTemplate)
+		(*in).DeepCopyInto(*out)
+	}
+	in.KubemarkOptions.DeepCopyInto(&out.KubemarkOptions)
+	if in.ProvisioningDelay != nil {
+		in, out := &in.ProvisioningDelay, &out.ProvisioningDelay
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Chaos != nil {
+		in, out := &in.Chaos, &out.Chaos
+		*out = new(KubemarkChaos)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.KubeletConfig != nil {
+		in, out := &in.KubeletConfig, &out.KubeletConfig
+		*out = new(KubemarkKubeletConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecurityContext != nil {
+		in, out := &in.SecurityContext, &out.SecurityContext
+		*out = new(corev1.SecurityContext)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ClientCertificateSecretRef != nil {
+		in, out := &in.ClientCertificateSecretRef, &out.ClientCertificateSecretRef
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+	if in.NodeInfo != nil {
+		in, out := &in.NodeInfo, &out.NodeInfo
+		*out = new(KubemarkNodeInfo)
+		**out = **in
+	}
+	if in.Interruption != nil {
+		in, out := &in.Interruption, &out.Interruption
+		*out = new(KubemarkInterruption)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NodeConditions != nil {
+		in, out := &in.NodeConditions, &out.NodeConditions
+		*out = make([]KubemarkNodeCondition, len(*in))
+		copy(*out, *in)
+	}
+	if in.VolumeAttachLimits != nil {
+		in, out := &in.VolumeAttachLimits, &out.VolumeAttachLimits
+		*out = make([]KubemarkVolumeAttachLimit, len(*in))
+		copy(*out, *in)
+	}
+	if in.FakeCSIDriver != nil {
+		in, out := &in.FakeCSIDriver, &out.FakeCSIDriver
+		*out = new(KubemarkFakeCSIDriver)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DevicePlugin != nil {
+		in, out := &in.DevicePlugin, &out.DevicePlugin
+		*out = new(KubemarkDevicePlugin)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkMachineSpec.
@@ -102,6 +620,21 @@ func (in *KubemarkMachineSpec) DeepCopy() *KubemarkMachineSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KubemarkMachineStatus) DeepCopyInto(out *KubemarkMachineStatus) {
 	*out = *in
+	if in.ProvisioningDuration != nil {
+		in, out := &in.ProvisioningDuration, &out.ProvisioningDuration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.FailureReason != nil {
+		in, out := &in.FailureReason, &out.FailureReason
+		*out = new(errors.MachineStatusError)
+		**out = **in
+	}
+	if in.FailureMessage != nil {
+		in, out := &in.FailureMessage, &out.FailureMessage
+		*out = new(string)
+		**out = **in
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make(apiv1alpha4.Conditions, len(*in))
@@ -126,7 +659,8 @@ func (in *KubemarkMachineTemplate) DeepCopyInto(out *KubemarkMachineTemplate) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkMachineTemplate.
@@ -182,7 +716,7 @@ func (in *KubemarkMachineTemplateList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KubemarkMachineTemplateResource) DeepCopyInto(out *KubemarkMachineTemplateResource) {
 	*out = *in
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkMachineTemplateResource.
@@ -198,7 +732,12 @@ func (in *KubemarkMachineTemplateResource) DeepCopy() *KubemarkMachineTemplateRe
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KubemarkMachineTemplateSpec) DeepCopyInto(out *KubemarkMachineTemplateSpec) {
 	*out = *in
-	out.Template = in.Template
+	in.Template.DeepCopyInto(&out.Template)
+	if in.PodDisruptionBudget != nil {
+		in, out := &in.PodDisruptionBudget, &out.PodDisruptionBudget
+		*out = new(KubemarkPodDisruptionBudget)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkMachineTemplateSpec.
@@ -210,3 +749,327 @@ func (in *KubemarkMachineTemplateSpec) DeepCopy() *KubemarkMachineTemplateSpec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkMachineTemplateStatus) DeepCopyInto(out *KubemarkMachineTemplateStatus) {
+	*out = *in
+	if in.Capacity != nil {
+		in, out := &in.Capacity, &out.Capacity
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkMachineTemplateStatus.
+func (in *KubemarkMachineTemplateStatus) DeepCopy() *KubemarkMachineTemplateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkMachineTemplateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkNodeCondition) DeepCopyInto(out *KubemarkNodeCondition) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkNodeCondition.
+func (in *KubemarkNodeCondition) DeepCopy() *KubemarkNodeCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkNodeCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkNodeInfo) DeepCopyInto(out *KubemarkNodeInfo) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkNodeInfo.
+func (in *KubemarkNodeInfo) DeepCopy() *KubemarkNodeInfo {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkNodeInfo)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkPodDisruptionBudget) DeepCopyInto(out *KubemarkPodDisruptionBudget) {
+	*out = *in
+	if in.MinAvailable != nil {
+		in, out := &in.MinAvailable, &out.MinAvailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkPodDisruptionBudget.
+func (in *KubemarkPodDisruptionBudget) DeepCopy() *KubemarkPodDisruptionBudget {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkPodDisruptionBudget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkPodTemplate) DeepCopyInto(out *KubemarkPodTemplate) {
+	*out = *in
+	if in.TopologySpreadConstraints != nil {
+		in, out := &in.TopologySpreadConstraints, &out.TopologySpreadConstraints
+		*out = make([]corev1.TopologySpreadConstraint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Overlay != nil {
+		in, out := &in.Overlay, &out.Overlay
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkPodTemplate.
+func (in *KubemarkPodTemplate) DeepCopy() *KubemarkPodTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkPodTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkPressure) DeepCopyInto(out *KubemarkPressure) {
+	*out = *in
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Duration != nil {
+		in, out := &in.Duration, &out.Duration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkPressure.
+func (in *KubemarkPressure) DeepCopy() *KubemarkPressure {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkPressure)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkProcessOptions) DeepCopyInto(out *KubemarkProcessOptions) {
+	*out = *in
+	if in.ExtendedResources != nil {
+		in, out := &in.ExtendedResources, &out.ExtendedResources
+		*out = make(KubemarkExtendedResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkProcessOptions.
+func (in *KubemarkProcessOptions) DeepCopy() *KubemarkProcessOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkProcessOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkReadinessFlap) DeepCopyInto(out *KubemarkReadinessFlap) {
+	*out = *in
+	out.Interval = in.Interval
+	out.Downtime = in.Downtime
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkReadinessFlap.
+func (in *KubemarkReadinessFlap) DeepCopy() *KubemarkReadinessFlap {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkReadinessFlap)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkVolumeAttachLimit) DeepCopyInto(out *KubemarkVolumeAttachLimit) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkVolumeAttachLimit.
+func (in *KubemarkVolumeAttachLimit) DeepCopy() *KubemarkVolumeAttachLimit {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkVolumeAttachLimit)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkWorkload) DeepCopyInto(out *KubemarkWorkload) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkWorkload.
+func (in *KubemarkWorkload) DeepCopy() *KubemarkWorkload {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkWorkload)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KubemarkWorkload) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkWorkloadList) DeepCopyInto(out *KubemarkWorkloadList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]KubemarkWorkload, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkWorkloadList.
+func (in *KubemarkWorkloadList) DeepCopy() *KubemarkWorkloadList {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkWorkloadList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KubemarkWorkloadList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkWorkloadPodSize) DeepCopyInto(out *KubemarkWorkloadPodSize) {
+	*out = *in
+	if in.Weight != nil {
+		in, out := &in.Weight, &out.Weight
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Requests != nil {
+		in, out := &in.Requests, &out.Requests
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkWorkloadPodSize.
+func (in *KubemarkWorkloadPodSize) DeepCopy() *KubemarkWorkloadPodSize {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkWorkloadPodSize)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkWorkloadSpec) DeepCopyInto(out *KubemarkWorkloadSpec) {
+	*out = *in
+	out.Lifetime = in.Lifetime
+	if in.MaxPods != nil {
+		in, out := &in.MaxPods, &out.MaxPods
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Sizes != nil {
+		in, out := &in.Sizes, &out.Sizes
+		*out = make([]KubemarkWorkloadPodSize, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkWorkloadSpec.
+func (in *KubemarkWorkloadSpec) DeepCopy() *KubemarkWorkloadSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkWorkloadSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubemarkWorkloadStatus) DeepCopyInto(out *KubemarkWorkloadStatus) {
+	*out = *in
+	if in.LastCreationTime != nil {
+		in, out := &in.LastCreationTime, &out.LastCreationTime
+		*out = new(v1.Time)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubemarkWorkloadStatus.
+func (in *KubemarkWorkloadStatus) DeepCopy() *KubemarkWorkloadStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KubemarkWorkloadStatus)
+	in.DeepCopyInto(out)
+	return out
+}
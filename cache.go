@@ -0,0 +1,134 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// multiNamespaceCacheBuilder returns a cache restricted to the given
+// namespaces. Unlike cache.MultiNamespacedCacheBuilder, cluster-scoped objects
+// such as KubemarkInstanceTypes are served from a cluster-wide cache, which
+// only ever holds the cluster-scoped kinds the controllers read.
+func multiNamespaceCacheBuilder(namespaces []string) cache.NewCacheFunc {
+	return func(config *rest.Config, opts cache.Options) (cache.Cache, error) {
+		namespaced, err := cache.MultiNamespacedCacheBuilder(namespaces)(config, opts)
+		if err != nil {
+			return nil, err
+		}
+		opts.Namespace = ""
+		clusterScoped, err := cache.New(config, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &scopedCache{
+			Cache:         namespaced,
+			clusterScoped: clusterScoped,
+			opts:          opts,
+		}, nil
+	}
+}
+
+// scopedCache routes cluster-scoped kinds to clusterScoped and all others to
+// the embedded namespaced cache.
+type scopedCache struct {
+	cache.Cache
+	clusterScoped cache.Cache
+	opts          cache.Options
+}
+
+func (c *scopedCache) cacheForKind(gvk schema.GroupVersionKind) (cache.Cache, error) {
+	gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+	mapping, err := c.opts.Mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, err
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		return c.clusterScoped, nil
+	}
+	return c.Cache, nil
+}
+
+func (c *scopedCache) cacheFor(obj runtime.Object) (cache.Cache, error) {
+	gvk, err := apiutil.GVKForObject(obj, c.opts.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	return c.cacheForKind(gvk)
+}
+
+func (c *scopedCache) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	target, err := c.cacheFor(obj)
+	if err != nil {
+		return err
+	}
+	return target.Get(ctx, key, obj)
+}
+
+func (c *scopedCache) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	target, err := c.cacheFor(list)
+	if err != nil {
+		return err
+	}
+	return target.List(ctx, list, opts...)
+}
+
+func (c *scopedCache) GetInformer(ctx context.Context, obj client.Object) (cache.Informer, error) {
+	target, err := c.cacheFor(obj)
+	if err != nil {
+		return nil, err
+	}
+	return target.GetInformer(ctx, obj)
+}
+
+func (c *scopedCache) GetInformerForKind(ctx context.Context, gvk schema.GroupVersionKind) (cache.Informer, error) {
+	target, err := c.cacheForKind(gvk)
+	if err != nil {
+		return nil, err
+	}
+	return target.GetInformerForKind(ctx, gvk)
+}
+
+func (c *scopedCache) IndexField(ctx context.Context, obj client.Object, field string, extractValue client.IndexerFunc) error {
+	target, err := c.cacheFor(obj)
+	if err != nil {
+		return err
+	}
+	return target.IndexField(ctx, obj, field, extractValue)
+}
+
+func (c *scopedCache) Start(ctx context.Context) error {
+	go func() {
+		if err := c.clusterScoped.Start(ctx); err != nil {
+			setupLog.Error(err, "failed to start the cache of cluster-scoped objects")
+		}
+	}()
+	return c.Cache.Start(ctx)
+}
+
+func (c *scopedCache) WaitForCacheSync(ctx context.Context) bool {
+	return c.clusterScoped.WaitForCacheSync(ctx) && c.Cache.WaitForCacheSync(ctx)
+}
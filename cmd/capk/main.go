@@ -0,0 +1,159 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command capk holds client-side helpers for working with Kubemark machines.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/diff"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/cache"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "github.com/benmoss/cluster-api-provider-kubemark/api/v1alpha4"
+	"github.com/benmoss/cluster-api-provider-kubemark/controllers"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = infrav1.AddToScheme(scheme)
+	_ = clusterv1.AddToScheme(scheme)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s diff -f <template.yaml> --machinedeployment <name> [-n <namespace>]\n", os.Args[0])
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	switch os.Args[1] {
+	case "diff":
+		if err := runDiff(ctrl.SetupSignalHandler(), os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+// runDiff prints how the hollow node pods of a MachineDeployment would change
+// if it were switched to the KubemarkMachineTemplate in the given file.
+func runDiff(ctx context.Context, args []string) error {
+	var file, machineDeploymentName, namespace, kubemarkImage, versionImages string
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.StringVar(&file, "f", "", "The file holding the proposed KubemarkMachineTemplate")
+	fs.StringVar(&machineDeploymentName, "machinedeployment", "", "The MachineDeployment to compare against")
+	fs.StringVar(&namespace, "n", "default", "The namespace of the MachineDeployment")
+	fs.StringVar(&kubemarkImage, "kubemark-image", "gcr.io/cf-london-servces-k8s/bmo/kubemark", "The location of the kubemark image")
+	fs.StringVar(&versionImages, "version-images", "", "The <namespace>/<name> of the ConfigMap mapping Kubernetes versions to kubemark images, as passed to the controller")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if file == "" || machineDeploymentName == "" {
+		usage()
+		os.Exit(2)
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	proposed := &infrav1.KubemarkMachineTemplate{}
+	if _, _, err := serializer.NewCodecFactory(scheme).UniversalDeserializer().Decode(data, nil, proposed); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", file, err)
+	}
+
+	c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+	machineDeployment := &clusterv1.MachineDeployment{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: machineDeploymentName}, machineDeployment); err != nil {
+		return err
+	}
+	infraRef := machineDeployment.Spec.Template.Spec.InfrastructureRef
+	if infraRef.Kind != "KubemarkMachineTemplate" {
+		return fmt.Errorf("MachineDeployment %s does not use a KubemarkMachineTemplate", machineDeploymentName)
+	}
+	current := &infrav1.KubemarkMachineTemplate{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: infraRef.Name}, current); err != nil {
+		return err
+	}
+
+	version := machineDeployment.Spec.Template.Spec.Version
+	if version == nil {
+		return fmt.Errorf("MachineDeployment %s has no spec.template.spec.version", machineDeploymentName)
+	}
+	var images map[string]string
+	if versionImages != "" {
+		imagesNamespace, imagesName, err := cache.SplitMetaNamespaceKey(versionImages)
+		if err != nil {
+			return err
+		}
+		configMap := &corev1.ConfigMap{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: imagesNamespace, Name: imagesName}, configMap); err != nil {
+			return err
+		}
+		images = configMap.Data
+	}
+	currentPod, err := previewPod(ctx, c, current, kubemarkImage, images, *version)
+	if err != nil {
+		return err
+	}
+	proposedPod, err := previewPod(ctx, c, proposed, kubemarkImage, images, *version)
+	if err != nil {
+		return err
+	}
+
+	if d := diff.ObjectReflectDiff(currentPod.Spec, proposedPod.Spec); d != "" {
+		fmt.Printf("Rolling out %s would change the hollow node pods (-current +proposed):\n%s", file, d)
+		return nil
+	}
+	fmt.Println("No changes to the hollow node pods")
+	return nil
+}
+
+// previewPod renders the hollow node pod for a template, resolving its
+// instance type from the cluster.
+func previewPod(ctx context.Context, c client.Client, template *infrav1.KubemarkMachineTemplate, kubemarkImage string, versionImages map[string]string, version string) (*corev1.Pod, error) {
+	spec := template.Spec.Template.Spec
+	var instanceType *infrav1.KubemarkInstanceType
+	if spec.InstanceType != "" {
+		instanceType = &infrav1.KubemarkInstanceType{}
+		if err := c.Get(ctx, client.ObjectKey{Name: spec.InstanceType}, instanceType); err != nil {
+			return nil, err
+		}
+	}
+	return controllers.PreviewHollowNodePod(spec, instanceType, kubemarkImage, versionImages, version)
+}
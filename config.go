@@ -0,0 +1,91 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// The apiVersion and kind of the manager configuration file.
+const (
+	configAPIVersion = "controller.infrastructure.cluster.x-k8s.io/v1alpha1"
+	configKind       = "KubemarkControllerConfiguration"
+)
+
+// loadConfigFile sets the flags of fs from the configuration file at path.
+// Besides its apiVersion and kind, the file maps flag names to their values:
+//
+//	apiVersion: controller.infrastructure.cluster.x-k8s.io/v1alpha1
+//	kind: KubemarkControllerConfiguration
+//	max-provisions-per-second: 50
+//	kubemark-image: registry.example.com/kubemark
+//
+// Flags set on the command line take precedence over the file.
+func loadConfigFile(fs *flag.FlagSet, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	settings := map[string]json.RawMessage{}
+	if err := yaml.NewYAMLOrJSONDecoder(file, 4096).Decode(&settings); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+
+	var apiVersion, kind string
+	_ = json.Unmarshal(settings["apiVersion"], &apiVersion)
+	_ = json.Unmarshal(settings["kind"], &kind)
+	if apiVersion != configAPIVersion || kind != configKind {
+		return fmt.Errorf("%s must be a %s of %s", path, configKind, configAPIVersion)
+	}
+	delete(settings, "apiVersion")
+	delete(settings, "kind")
+
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("%s sets unknown flag %q", path, name)
+		}
+		if explicit[name] {
+			continue
+		}
+		// Strings are unquoted, numbers and booleans are taken as written.
+		value := string(settings[name])
+		var s string
+		if err := json.Unmarshal(settings[name], &s); err == nil {
+			value = s
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("%s sets invalid %s: %w", path, name, err)
+		}
+	}
+	return nil
+}
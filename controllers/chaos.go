@@ -0,0 +1,163 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"time"
+
+	infrav1 "github.com/benmoss/cluster-api-provider-kubemark/api/v1alpha4"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// interruptionNoticeCondition is the Node condition announcing the
+// interruption of a machine, like the notices of spot instances.
+const interruptionNoticeCondition v1.NodeConditionType = "InterruptionNotice"
+
+// readinessFlap reports whether the hollow node of a machine should currently
+// be stopped by its readiness flap or a heartbeat stall injected by a chaos
+// campaign, and how long until that changes. The returned duration is zero
+// when neither applies.
+func readinessFlap(kubemarkMachine *infrav1.KubemarkMachine, now time.Time) (bool, time.Duration) {
+	if stalled, remaining := heartbeatsStalled(kubemarkMachine, now); stalled {
+		return true, remaining
+	}
+	chaos := kubemarkMachine.Spec.Chaos
+	if chaos == nil || chaos.ReadinessFlap == nil || kubemarkMachine.Status.ProvisioningDuration == nil {
+		return false, 0
+	}
+	return periodicDowntime(kubemarkMachine, chaos.ReadinessFlap.Interval.Duration, chaos.ReadinessFlap.Downtime.Duration, now)
+}
+
+// periodicDowntime reports whether a ready machine is currently in the
+// downtime at the end of every interval, counted from the moment it first
+// became ready, and how long until that changes. The returned duration is
+// zero when the schedule is invalid.
+func periodicDowntime(kubemarkMachine *infrav1.KubemarkMachine, interval, downtime time.Duration, now time.Time) (bool, time.Duration) {
+	if interval <= 0 || downtime <= 0 || downtime >= interval {
+		return false, 0
+	}
+
+	// Every interval starts with the node up and ends with the downtime.
+	readyAt := kubemarkMachine.CreationTimestamp.Add(kubemarkMachine.Status.ProvisioningDuration.Duration)
+	if now.Before(readyAt) {
+		return false, readyAt.Sub(now) + interval - downtime
+	}
+	phase := now.Sub(readyAt) % interval
+	if phase >= interval-downtime {
+		return true, interval - phase
+	}
+	return false, interval - downtime - phase
+}
+
+// interruptionTime returns when a machine with an interruption is
+// interrupted, and whether it is. The time is drawn from an exponential
+// distribution seeded with the machine UID, so it stays the same across
+// reconciles and restarts.
+func interruptionTime(kubemarkMachine *infrav1.KubemarkMachine) (time.Time, bool) {
+	interruption := kubemarkMachine.Spec.Interruption
+	if interruption == nil || interruption.MeanTimeBetween.Duration <= 0 || kubemarkMachine.Status.ProvisioningDuration == nil {
+		return time.Time{}, false
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(kubemarkMachine.UID))
+	random := rand.New(rand.NewSource(int64(h.Sum64())))
+	after := time.Duration(random.ExpFloat64() * float64(interruption.MeanTimeBetween.Duration))
+
+	readyAt := kubemarkMachine.CreationTimestamp.Add(kubemarkMachine.Status.ProvisioningDuration.Duration)
+	return readyAt.Add(after), true
+}
+
+// interruptionNotice returns the Node condition announcing the interruption
+// of a machine at interruptAt.
+func interruptionNotice(interruptAt time.Time, notice time.Duration) v1.NodeCondition {
+	return v1.NodeCondition{
+		Type:               interruptionNoticeCondition,
+		Status:             v1.ConditionTrue,
+		Reason:             "InstanceInterrupted",
+		Message:            "the instance is interrupted at " + interruptAt.UTC().Format(time.RFC3339),
+		LastHeartbeatTime:  metav1.Now(),
+		LastTransitionTime: metav1.NewTime(interruptAt.Add(-notice)),
+	}
+}
+
+// heartbeatsStalled reports whether the heartbeats of the Node of a machine
+// are stalled by its HeartbeatsStalledUntilAnnotation, and for how long.
+func heartbeatsStalled(kubemarkMachine *infrav1.KubemarkMachine, now time.Time) (bool, time.Duration) {
+	value, ok := kubemarkMachine.Annotations[infrav1.HeartbeatsStalledUntilAnnotation]
+	if !ok {
+		return false, 0
+	}
+	until, err := time.Parse(time.RFC3339, value)
+	if err != nil || !now.Before(until) {
+		return false, 0
+	}
+	return true, until.Sub(now)
+}
+
+// nodePressure returns the pressure conditions the Node of a machine should
+// currently report true, and how long until that changes. The returned
+// duration is zero when no periodic pressure applies.
+func nodePressure(kubemarkMachine *infrav1.KubemarkMachine, now time.Time) (map[v1.NodeConditionType]bool, time.Duration) {
+	chaos := kubemarkMachine.Spec.Chaos
+	if chaos == nil || len(chaos.Pressure) == 0 {
+		return nil, 0
+	}
+	pressure := map[v1.NodeConditionType]bool{}
+	var next time.Duration
+	for _, p := range chaos.Pressure {
+		if p.Interval == nil || p.Duration == nil {
+			pressure[p.Condition] = true
+			continue
+		}
+		if kubemarkMachine.Status.ProvisioningDuration == nil {
+			continue
+		}
+		active, remaining := periodicDowntime(kubemarkMachine, p.Interval.Duration, p.Duration.Duration, now)
+		if active {
+			pressure[p.Condition] = true
+		}
+		if remaining > 0 && (next == 0 || remaining < next) {
+			next = remaining
+		}
+	}
+	return pressure, next
+}
+
+// unhealthyDevices returns the number of devices of the device plugin of a
+// machine that are unhealthy, and the time until that changes if it is
+// periodic.
+func unhealthyDevices(kubemarkMachine *infrav1.KubemarkMachine, now time.Time) (int32, time.Duration) {
+	plugin := kubemarkMachine.Spec.DevicePlugin
+	if plugin == nil || plugin.Unhealthy == nil {
+		return 0, 0
+	}
+	unhealthy := plugin.Unhealthy
+	if unhealthy.Interval == nil || unhealthy.Duration == nil {
+		return unhealthy.Count, 0
+	}
+	if kubemarkMachine.Status.ProvisioningDuration == nil {
+		return 0, 0
+	}
+	active, remaining := periodicDowntime(kubemarkMachine, unhealthy.Interval.Duration, unhealthy.Duration.Duration, now)
+	if active {
+		return unhealthy.Count, remaining
+	}
+	return 0, remaining
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/cluster-api/controllers/remote"
+	"sigs.k8s.io/cluster-api/util"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// workloadClusterReachable reports the result of the last probe of each
+// workload cluster.
+var workloadClusterReachable = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "capk_workload_cluster_reachable",
+	Help: "Whether the API server of a workload cluster answered its last health probe.",
+}, []string{"namespace", "cluster"})
+
+func init() {
+	metrics.Registry.MustRegister(workloadClusterReachable)
+}
+
+// ClusterProber periodically probes the API server of every workload cluster
+// whose infrastructure is ready. While one is down, the controllers back off
+// from its machines without trying each of them, instead of every machine
+// logging its own connection errors.
+type ClusterProber struct {
+	Client client.Client
+	// Interval is the time between two probes of a cluster.
+	Interval time.Duration
+	// Timeout bounds each probe.
+	Timeout time.Duration
+
+	lock        sync.RWMutex
+	unreachable map[types.UID]error
+	probed      map[types.UID][]string
+}
+
+// Start probes the clusters every interval until the context is done.
+func (p *ClusterProber) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, p.probeAll, p.Interval)
+	return nil
+}
+
+// NeedLeaderElection is false, every replica of the manager reports the
+// reachability of the clusters.
+func (p *ClusterProber) NeedLeaderElection() bool {
+	return false
+}
+
+// Unreachable returns why the workload cluster did not answer its last probe,
+// or nil if it did or was not probed yet. A nil ClusterProber finds every
+// cluster reachable.
+func (p *ClusterProber) Unreachable(cluster *clusterv1.Cluster) error {
+	if p == nil {
+		return nil
+	}
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.unreachable[cluster.UID]
+}
+
+func (p *ClusterProber) probeAll(ctx context.Context) {
+	clusters := &clusterv1.ClusterList{}
+	if err := p.Client.List(ctx, clusters); err != nil {
+		ctrl.Log.WithName("cluster-prober").Error(err, "failed to list clusters")
+		return
+	}
+
+	unreachable := map[types.UID]error{}
+	probed := map[types.UID][]string{}
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for i := range clusters.Items {
+		cluster := &clusters.Items[i]
+		if !cluster.Status.InfrastructureReady || !cluster.DeletionTimestamp.IsZero() {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := p.probe(ctx, cluster)
+			lock.Lock()
+			defer lock.Unlock()
+			probed[cluster.UID] = []string{cluster.Namespace, cluster.Name}
+			if err != nil {
+				unreachable[cluster.UID] = err
+				workloadClusterReachable.WithLabelValues(cluster.Namespace, cluster.Name).Set(0)
+			} else {
+				workloadClusterReachable.WithLabelValues(cluster.Namespace, cluster.Name).Set(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	logger := ctrl.Log.WithName("cluster-prober")
+	for uid, labels := range probed {
+		err, wasUnreachable := unreachable[uid], p.unreachable[uid] != nil
+		switch {
+		case err != nil && !wasUnreachable:
+			logger.Info("workload cluster is unreachable", "namespace", labels[0], "cluster", labels[1], "reason", err.Error())
+		case err == nil && wasUnreachable:
+			logger.Info("workload cluster is reachable again", "namespace", labels[0], "cluster", labels[1])
+		}
+	}
+	for uid, labels := range p.probed {
+		if _, ok := probed[uid]; !ok {
+			workloadClusterReachable.DeleteLabelValues(labels...)
+		}
+	}
+	p.unreachable, p.probed = unreachable, probed
+}
+
+// probe checks that the API server of a cluster answers /healthz.
+func (p *ClusterProber) probe(ctx context.Context, cluster *clusterv1.Cluster) error {
+	restConfig, err := remote.RESTConfig(ctx, p.Client, util.ObjectKey(cluster))
+	if err != nil {
+		return err
+	}
+	restConfig.Timeout = p.Timeout
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+	if err := discoveryClient.RESTClient().Get().AbsPath("/healthz").Do(ctx).Error(); err != nil {
+		return fmt.Errorf("workload cluster %s is unreachable: %w", cluster.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	infrav1 "github.com/benmoss/cluster-api-provider-kubemark/api/v1alpha4"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// +kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get
+
+// expectedCRD describes a CRD the controller relies on and the object whose
+// fields its schema must know about.
+type expectedCRD struct {
+	resource string
+	// path leads from the root of the schema to the object described by typ.
+	path []string
+	typ  reflect.Type
+}
+
+var expectedCRDs = []expectedCRD{
+	{
+		resource: "kubemarkmachines",
+		path:     []string{"spec"},
+		typ:      reflect.TypeOf(infrav1.KubemarkMachineSpec{}),
+	},
+	{
+		resource: "kubemarkmachines",
+		path:     []string{"status"},
+		typ:      reflect.TypeOf(infrav1.KubemarkMachineStatus{}),
+	},
+	{
+		resource: "kubemarkmachinetemplates",
+		path:     []string{"spec", "template", "spec"},
+		typ:      reflect.TypeOf(infrav1.KubemarkMachineSpec{}),
+	},
+	{
+		resource: "kubemarkinstancetypes",
+		path:     []string{"spec"},
+		typ:      reflect.TypeOf(infrav1.KubemarkInstanceTypeSpec{}),
+	},
+	{
+		resource: "kubemarkchaoscampaigns",
+		path:     []string{"spec"},
+		typ:      reflect.TypeOf(infrav1.KubemarkChaosCampaignSpec{}),
+	},
+	{
+		resource: "kubemarkworkloads",
+		path:     []string{"spec"},
+		typ:      reflect.TypeOf(infrav1.KubemarkWorkloadSpec{}),
+	},
+}
+
+// CheckCRDs verifies that the installed CRDs serve the API version this
+// controller was built against and know about every field it writes. A CRD
+// left behind by a partial upgrade would otherwise silently prune new fields.
+func CheckCRDs(ctx context.Context, c client.Reader) error {
+	var errs []error
+	for _, expected := range expectedCRDs {
+		if err := checkCRD(ctx, c, expected); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return kerrors.NewAggregate(errs)
+}
+
+func checkCRD(ctx context.Context, c client.Reader, expected expectedCRD) error {
+	name := fmt.Sprintf("%s.%s", expected.resource, infrav1.GroupVersion.Group)
+	crd := &unstructured.Unstructured{}
+	crd.SetGroupVersionKind(schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"})
+	if err := c.Get(ctx, client.ObjectKey{Name: name}, crd); err != nil {
+		return fmt.Errorf("failed to get CRD %s: %w", name, err)
+	}
+
+	versions, _, err := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	if err != nil {
+		return fmt.Errorf("CRD %s: %w", name, err)
+	}
+	for _, v := range versions {
+		version, ok := v.(map[string]interface{})
+		if !ok || version["name"] != infrav1.GroupVersion.Version {
+			continue
+		}
+		if served, _ := version["served"].(bool); !served {
+			return fmt.Errorf("CRD %s does not serve %s", name, infrav1.GroupVersion.Version)
+		}
+		fields := []string{"schema", "openAPIV3Schema"}
+		for _, p := range expected.path {
+			fields = append(fields, "properties", p)
+		}
+		fields = append(fields, "properties")
+		properties, _, err := unstructured.NestedMap(version, fields...)
+		if err != nil {
+			return fmt.Errorf("CRD %s: %w", name, err)
+		}
+		var missing []string
+		for _, field := range jsonFields(expected.typ) {
+			if _, ok := properties[field]; !ok {
+				missing = append(missing, field)
+			}
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			return fmt.Errorf("CRD %s is older than the controller: %s is missing %s",
+				name, strings.Join(expected.path, "."), strings.Join(missing, ", "))
+		}
+		return nil
+	}
+	return fmt.Errorf("CRD %s does not define %s", name, infrav1.GroupVersion.Version)
+}
+
+// jsonFields returns the serialized names of the fields of a struct type.
+func jsonFields(t reflect.Type) []string {
+	var fields []string
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		fields = append(fields, tag)
+	}
+	return fields
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Drainer lets the reconciliations in flight when the manager stops run to
+// completion, rather than abandoning a machine between two writes. The
+// manager stops handing out requests on shutdown, but cancels the context of
+// those already running; the reconcilers wrapped by a Drainer run with a
+// context of its own instead, cancelled only once Drain gives up.
+type Drainer struct {
+	inFlight sync.WaitGroup
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// NewDrainer returns a Drainer with no reconciliations in flight.
+func NewDrainer() *Drainer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Drainer{ctx: ctx, cancel: cancel}
+}
+
+// wrap tracks the reconciliations of r. A nil Drainer leaves r as it is.
+func (d *Drainer) wrap(r reconcile.Reconciler) reconcile.Reconciler {
+	if d == nil {
+		return r
+	}
+	return reconcile.Func(func(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+		d.inFlight.Add(1)
+		defer d.inFlight.Done()
+		return r.Reconcile(drainContext{Context: ctx, done: d.ctx}, req)
+	})
+}
+
+// Drain waits up to timeout for the reconciliations in flight to finish,
+// then cancels those left. It returns whether all of them finished.
+func (d *Drainer) Drain(timeout time.Duration) bool {
+	defer d.cancel()
+	finished := make(chan struct{})
+	go func() {
+		d.inFlight.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// drainContext carries the values of the context of a reconciliation, such as
+// its logger, but is only done when the Drainer gives up.
+type drainContext struct {
+	context.Context
+	done context.Context
+}
+
+func (c drainContext) Deadline() (time.Time, bool) { return c.done.Deadline() }
+func (c drainContext) Done() <-chan struct{}       { return c.done.Done() }
+func (c drainContext) Err() error                  { return c.done.Err() }
@@ -0,0 +1,484 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	infrav1 "github.com/benmoss/cluster-api-provider-kubemark/api/v1alpha4"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The heartbeat settings of the Node of a machine with the node backend
+// unless its kubelet config says otherwise, the defaults of the kubelet.
+const (
+	defaultNodeLeaseDurationSeconds  = 40
+	defaultNodeStatusReportFrequency = 5 * time.Minute
+)
+
+// The Windows specifics of a Node with the windows OS family, those of a
+// Windows Server 2019 node.
+const (
+	windowsBuildLabel       = "node.kubernetes.io/windows-build"
+	windowsBuild            = "10.0.17763"
+	windowsOSImage          = "Windows Server 2019 Datacenter"
+	windowsKernelVersion    = "10.0.17763.1577"
+	windowsContainerRuntime = "docker://19.3.14"
+)
+
+// fakeNodeDefaults are the resources a Node without a hollow kubelet
+// registers unless its machine or instance type set them, the same as a
+// hollow kubelet.
+var fakeNodeDefaults = v1.ResourceList{
+	v1.ResourceCPU:    resource.MustParse("1"),
+	v1.ResourceMemory: resource.MustParse("3840Mi"),
+	v1.ResourcePods:   resource.MustParse("110"),
+}
+
+type fakeNodeInput struct {
+	kubemarkMachine *infrav1.KubemarkMachine
+	instanceType    *infrav1.KubemarkInstanceType
+	nodeName        string
+	providerID      string
+	version         string
+	// kubeletStub is the kubelet API the Node registers, if any.
+	kubeletStub *KubeletStub
+	// unhealthyDevices is the number of devices of the device plugin left
+	// out of the allocatable resources.
+	unhealthyDevices int32
+}
+
+// fakeNode returns a Node for a KubemarkMachine registered in the workload
+// cluster by the controller rather than by a hollow kubelet.
+func fakeNode(in *fakeNodeInput) (*v1.Node, error) {
+	resources := extendedResources(&in.kubemarkMachine.Spec, in.instanceType)
+	if err := validateExtendedResources(resources); err != nil {
+		return nil, err
+	}
+	capacity := fakeNodeDefaults.DeepCopy()
+	for name, quantity := range resources {
+		capacity[v1.ResourceName(name)] = quantity.DeepCopy()
+	}
+
+	labels := map[string]string{
+		v1.LabelHostname:   in.nodeName,
+		v1.LabelOSStable:   "linux",
+		v1.LabelArchStable: "amd64",
+	}
+	nodeInfo := v1.NodeSystemInfo{
+		KubeletVersion:  in.version,
+		OperatingSystem: "linux",
+		Architecture:    "amd64",
+	}
+	if arch := in.kubemarkMachine.Spec.Architecture; arch != "" {
+		labels[v1.LabelArchStable] = string(arch)
+		nodeInfo.Architecture = string(arch)
+	}
+	var taints []v1.Taint
+	if in.kubemarkMachine.Spec.OSFamily == infrav1.KubemarkOSFamilyWindows {
+		labels[v1.LabelOSStable] = "windows"
+		labels[windowsBuildLabel] = windowsBuild
+		nodeInfo.OperatingSystem = "windows"
+		nodeInfo.OSImage = windowsOSImage
+		nodeInfo.KernelVersion = windowsKernelVersion
+		nodeInfo.ContainerRuntimeVersion = windowsContainerRuntime
+		// The taint Windows nodes are commonly registered with, which keeps
+		// Linux pods without a node selector off them.
+		taints = append(taints, v1.Taint{
+			Key:    "os",
+			Value:  "windows",
+			Effect: v1.TaintEffectNoSchedule,
+		})
+	}
+	if in.instanceType != nil {
+		for k, v := range in.instanceType.Spec.Labels {
+			labels[k] = v
+		}
+		labels[v1.LabelInstanceTypeStable] = in.instanceType.Name
+	}
+
+	if overrides := in.kubemarkMachine.Spec.NodeInfo; overrides != nil {
+		if overrides.OSImage != "" {
+			nodeInfo.OSImage = overrides.OSImage
+		}
+		if overrides.KernelVersion != "" {
+			nodeInfo.KernelVersion = overrides.KernelVersion
+		}
+		if overrides.ContainerRuntimeVersion != "" {
+			nodeInfo.ContainerRuntimeVersion = overrides.ContainerRuntimeVersion
+		}
+	}
+
+	var addresses []v1.NodeAddress
+	var daemonEndpoints v1.NodeDaemonEndpoints
+	if stub := in.kubeletStub; stub != nil {
+		addresses = []v1.NodeAddress{
+			{Type: v1.NodeInternalIP, Address: stub.Address},
+			{Type: v1.NodeHostName, Address: in.nodeName},
+		}
+		daemonEndpoints.KubeletEndpoint.Port = stub.Port
+	}
+
+	allocatable := capacity.DeepCopy()
+	if plugin := in.kubemarkMachine.Spec.DevicePlugin; plugin != nil {
+		allocatable[v1.ResourceName(devicePluginResource(plugin))] = healthyDevices(plugin, in.unhealthyDevices)
+	}
+
+	return &v1.Node{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1.SchemeGroupVersion.String(),
+			Kind:       "Node",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   in.nodeName,
+			Labels: labels,
+		},
+		Spec: v1.NodeSpec{
+			ProviderID: in.providerID,
+			Taints:     taints,
+		},
+		Status: v1.NodeStatus{
+			Capacity:        capacity,
+			Allocatable:     allocatable,
+			Conditions:      seededNodeConditions(in.kubemarkMachine, metav1.Now(), nil),
+			NodeInfo:        nodeInfo,
+			Addresses:       addresses,
+			DaemonEndpoints: daemonEndpoints,
+		},
+	}, nil
+}
+
+// devicePluginResource returns the resource of the devices of a device
+// plugin.
+func devicePluginResource(plugin *infrav1.KubemarkDevicePlugin) infrav1.KubemarkExtendedResourceName {
+	if plugin.ResourceName != "" {
+		return plugin.ResourceName
+	}
+	return infrav1.KubemarkExtendedResourceGPU
+}
+
+// healthyDevices returns the allocatable quantity of the devices of a device
+// plugin.
+func healthyDevices(plugin *infrav1.KubemarkDevicePlugin, unhealthy int32) resource.Quantity {
+	healthy := plugin.Devices - unhealthy
+	if healthy < 0 {
+		healthy = 0
+	}
+	return *resource.NewQuantity(int64(healthy), resource.DecimalSI)
+}
+
+// fakeNodeConditions returns the conditions a healthy kubelet reports, with
+// the given heartbeat time, turning the given pressure conditions true.
+func fakeNodeConditions(heartbeat metav1.Time, pressure map[v1.NodeConditionType]bool) []v1.NodeCondition {
+	conditions := []v1.NodeCondition{
+		{
+			Type:              v1.NodeMemoryPressure,
+			Status:            v1.ConditionFalse,
+			Reason:            "KubeletHasSufficientMemory",
+			Message:           "kubelet has sufficient memory available",
+			LastHeartbeatTime: heartbeat,
+		},
+		{
+			Type:              v1.NodeDiskPressure,
+			Status:            v1.ConditionFalse,
+			Reason:            "KubeletHasNoDiskPressure",
+			Message:           "kubelet has no disk pressure",
+			LastHeartbeatTime: heartbeat,
+		},
+		{
+			Type:              v1.NodePIDPressure,
+			Status:            v1.ConditionFalse,
+			Reason:            "KubeletHasSufficientPID",
+			Message:           "kubelet has sufficient PID available",
+			LastHeartbeatTime: heartbeat,
+		},
+		{
+			Type:              v1.NodeReady,
+			Status:            v1.ConditionTrue,
+			Reason:            "KubeletReady",
+			Message:           "kubelet is posting ready status",
+			LastHeartbeatTime: heartbeat,
+		},
+	}
+	for i := range conditions {
+		condition := &conditions[i]
+		if !pressure[condition.Type] {
+			continue
+		}
+		condition.Status = v1.ConditionTrue
+		condition.Reason, condition.Message = underPressure[condition.Type][0], underPressure[condition.Type][1]
+	}
+	return conditions
+}
+
+// underPressure are the reasons and messages of the pressure conditions a
+// kubelet reports true.
+var underPressure = map[v1.NodeConditionType][2]string{
+	v1.NodeMemoryPressure: {"KubeletHasInsufficientMemory", "kubelet has insufficient memory available"},
+	v1.NodeDiskPressure:   {"KubeletHasDiskPressure", "kubelet has disk pressure"},
+	v1.NodePIDPressure:    {"KubeletHasInsufficientPID", "kubelet has insufficient PID available"},
+}
+
+// seededNodeConditions returns the spec.nodeConditions of a machine its Node
+// does not report yet, as of now.
+func seededNodeConditions(kubemarkMachine *infrav1.KubemarkMachine, now metav1.Time, node *v1.Node) []v1.NodeCondition {
+	var seeded []v1.NodeCondition
+	for _, condition := range kubemarkMachine.Spec.NodeConditions {
+		if node != nil && hasNodeCondition(node, condition.Type) {
+			continue
+		}
+		seeded = append(seeded, v1.NodeCondition{
+			Type:               condition.Type,
+			Status:             condition.Status,
+			Reason:             condition.Reason,
+			Message:            condition.Message,
+			LastHeartbeatTime:  now,
+			LastTransitionTime: now,
+		})
+	}
+	return seeded
+}
+
+func hasNodeCondition(node *v1.Node, conditionType v1.NodeConditionType) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == conditionType {
+			return true
+		}
+	}
+	return false
+}
+
+// fakeNodeLease returns the Lease the kubelet of nodeName renews.
+func fakeNodeLease(nodeName string, durationSeconds int32, renewTime metav1.MicroTime) *coordinationv1.Lease {
+	return &coordinationv1.Lease{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: coordinationv1.SchemeGroupVersion.String(),
+			Kind:       "Lease",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nodeName,
+			Namespace: v1.NamespaceNodeLease,
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       pointer.StringPtr(nodeName),
+			LeaseDurationSeconds: pointer.Int32Ptr(durationSeconds),
+			RenewTime:            &renewTime,
+		},
+	}
+}
+
+// fakeNodeBackend registers the Node of a machine in the workload cluster
+// and posts its heartbeats itself. There is no pod and no kubelet, so pods
+// bound to the Node never start; it is meant for scale tests of the control
+// plane only.
+//
+// Like a kubelet, it renews the Lease of the Node every quarter of the lease
+// duration and only reports the Node status every status report period, or
+// when its pressure changed.
+type fakeNodeBackend struct {
+	client          client.Client
+	remoteResources RemoteResourceService
+	// kubeletStub is the kubelet API the Nodes register, if any.
+	kubeletStub *KubeletStub
+
+	lock sync.Mutex
+	// statusReported is the last status reported for each machine's Node.
+	// After a restart the status is reported right away.
+	statusReported map[types.UID]statusReport
+}
+
+// statusReport is a status reported for a Node.
+type statusReport struct {
+	time             time.Time
+	pressure         map[v1.NodeConditionType]bool
+	unhealthyDevices int32
+}
+
+func (b *fakeNodeBackend) Provision(ctx context.Context, in *NodeBackendInput) (ctrl.Result, error) {
+	logger := ctrl.LoggerFrom(ctx)
+	cluster, machine, kubemarkMachine := in.Cluster, in.Machine, in.KubemarkMachine
+	nodeName := kubemarkMachine.Name
+	now := metav1.Now()
+
+	leaseDurationSeconds := int32(defaultNodeLeaseDurationSeconds)
+	statusReportFrequency := defaultNodeStatusReportFrequency
+	if config := kubemarkMachine.Spec.KubeletConfig; config != nil {
+		if config.NodeLeaseDurationSeconds != nil {
+			leaseDurationSeconds = *config.NodeLeaseDurationSeconds
+		}
+		if config.NodeStatusReportFrequency != nil {
+			statusReportFrequency = config.NodeStatusReportFrequency.Duration
+		}
+	}
+	renewInterval := time.Duration(leaseDurationSeconds) * time.Second / 4
+	next := wait.Jitter(renewInterval, 0.04)
+	pressure, pressureNext := nodePressure(kubemarkMachine, now.Time)
+	if pressureNext > 0 && pressureNext < next {
+		next = pressureNext
+	}
+	unhealthy, unhealthyNext := unhealthyDevices(kubemarkMachine, now.Time)
+	if unhealthyNext > 0 && unhealthyNext < next {
+		next = unhealthyNext
+	}
+
+	if kubemarkMachine.Spec.ProviderID != nil {
+		// A readiness flap holds back the heartbeats, the node lifecycle
+		// controller of the workload cluster then turns the Node NotReady.
+		flapDown, flapNext := readinessFlap(kubemarkMachine, now.Time)
+		if flapDown {
+			logger.V(2).Info("Holding back node heartbeats for readiness flap or heartbeat stall", "remaining", flapNext.String())
+			b.forgetStatusReport(kubemarkMachine)
+			return ctrl.Result{RequeueAfter: flapNext}, nil
+		}
+		if flapNext > 0 && flapNext < next {
+			next = flapNext
+		}
+		if err := b.remoteResources.ApplyNodeLease(ctx, cluster, fakeNodeLease(nodeName, leaseDurationSeconds, metav1.NewMicroTime(now.Time))); err != nil {
+			logger.Error(err, "failed to renew node lease", "node", nodeName)
+			return ctrl.Result{}, err
+		}
+		due, transitions := b.statusReportDue(kubemarkMachine, now.Time, statusReportFrequency, pressure, unhealthy)
+		if !due {
+			return ctrl.Result{RequeueAfter: next}, nil
+		}
+		conditions := fakeNodeConditions(now, pressure)
+		for i := range conditions {
+			if transitions[conditions[i].Type] {
+				conditions[i].LastTransitionTime = now
+			}
+		}
+		err := b.remoteResources.PatchNodeConditions(ctx, cluster, nodeName, conditions)
+		if plugin := kubemarkMachine.Spec.DevicePlugin; err == nil && plugin != nil {
+			// Like a kubelet, report the healthy devices with the status.
+			err = b.remoteResources.PatchNodeAllocatable(ctx, cluster, nodeName, v1.ResourceList{
+				v1.ResourceName(devicePluginResource(plugin)): healthyDevices(plugin, unhealthy),
+			})
+		}
+		if err == nil {
+			b.recordStatusReport(kubemarkMachine, now.Time, pressure, unhealthy)
+			// The machine may have been stopped since it was provisioned.
+			in.Status.SetReady(kubemarkMachine, *kubemarkMachine.Spec.ProviderID)
+			return ctrl.Result{RequeueAfter: next}, nil
+		}
+		if !apierrors.IsNotFound(err) {
+			logger.Error(err, "failed to post node heartbeat", "node", nodeName)
+			return ctrl.Result{}, err
+		}
+		logger.Info("node was removed, registering it again", "node", nodeName)
+	}
+
+	if machine.Spec.Version == nil {
+		err := errors.New("Machine has no spec.version")
+		logger.Error(err, "")
+		return ctrl.Result{}, err
+	}
+	instanceType, err := getInstanceType(ctx, b.client, kubemarkMachine)
+	if err != nil {
+		logger.Error(err, "error finding instance type", "instanceType", kubemarkMachine.Spec.InstanceType)
+		return ctrl.Result{}, err
+	}
+	node, err := fakeNode(&fakeNodeInput{
+		kubemarkMachine:  kubemarkMachine,
+		instanceType:     instanceType,
+		nodeName:         nodeName,
+		providerID:       nodeProviderID(kubemarkMachine, machine, nodeName),
+		version:          *machine.Spec.Version,
+		kubeletStub:      b.kubeletStub,
+		unhealthyDevices: unhealthy,
+	})
+	if err != nil {
+		logger.Error(err, "failed to build node")
+		return ctrl.Result{}, err
+	}
+	node.Status.Conditions = append(fakeNodeConditions(now, pressure), node.Status.Conditions...)
+	for i := range node.Status.Conditions {
+		node.Status.Conditions[i].LastTransitionTime = now
+	}
+
+	if result, ok := in.acceptProvision(ctx); !ok {
+		return result, nil
+	}
+	start := time.Now()
+	err = b.remoteResources.ApplyNode(ctx, cluster, node)
+	observePhase(phaseNode, start, err)
+	if err != nil {
+		logger.Error(err, "failed to apply node", "node", nodeName)
+		return ctrl.Result{}, err
+	}
+	b.recordStatusReport(kubemarkMachine, now.Time, pressure, unhealthy)
+	if err := b.remoteResources.ApplyNodeLease(ctx, cluster, fakeNodeLease(nodeName, leaseDurationSeconds, metav1.NewMicroTime(now.Time))); err != nil {
+		logger.Error(err, "failed to renew node lease", "node", nodeName)
+		return ctrl.Result{}, err
+	}
+
+	in.Status.SetReady(kubemarkMachine, node.Spec.ProviderID)
+	return ctrl.Result{RequeueAfter: next}, nil
+}
+
+// Delete has nothing to remove besides the Node and its Lease, which the
+// reconciler deletes. The heartbeats stop with the machine.
+func (b *fakeNodeBackend) Delete(ctx context.Context, kubemarkMachine *infrav1.KubemarkMachine) (bool, error) {
+	b.forgetStatusReport(kubemarkMachine)
+	return true, nil
+}
+
+// statusReportDue reports whether the status of a machine's Node is due,
+// and which pressure conditions changed since it was last reported. A change
+// of the unhealthy devices makes it due too.
+func (b *fakeNodeBackend) statusReportDue(kubemarkMachine *infrav1.KubemarkMachine, now time.Time, frequency time.Duration, pressure map[v1.NodeConditionType]bool, unhealthyDevices int32) (bool, map[v1.NodeConditionType]bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	reported, ok := b.statusReported[kubemarkMachine.UID]
+	if !ok {
+		return true, nil
+	}
+	transitions := map[v1.NodeConditionType]bool{}
+	for condition := range underPressure {
+		if pressure[condition] != reported.pressure[condition] {
+			transitions[condition] = true
+		}
+	}
+	due := len(transitions) > 0 || unhealthyDevices != reported.unhealthyDevices || now.Sub(reported.time) >= frequency
+	return due, transitions
+}
+
+func (b *fakeNodeBackend) recordStatusReport(kubemarkMachine *infrav1.KubemarkMachine, now time.Time, pressure map[v1.NodeConditionType]bool, unhealthyDevices int32) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.statusReported == nil {
+		b.statusReported = map[types.UID]statusReport{}
+	}
+	b.statusReported[kubemarkMachine.UID] = statusReport{time: now, pressure: pressure, unhealthyDevices: unhealthyDevices}
+}
+
+func (b *fakeNodeBackend) forgetStatusReport(kubemarkMachine *infrav1.KubemarkMachine) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	delete(b.statusReported, kubemarkMachine.UID)
+}
@@ -0,0 +1,504 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+
+	infrav1 "github.com/benmoss/cluster-api-provider-kubemark/api/v1alpha4"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/cluster-api/util"
+)
+
+const (
+	// podSpecHashAnnotation records the hash of the spec a hollow node pod was
+	// built from, so that changes to the KubemarkMachine can be detected.
+	podSpecHashAnnotation = "infrastructure.cluster.x-k8s.io/kubemark-pod-spec-hash"
+
+	// provisionedFromAnnotation records the fingerprint of the objects a
+	// hollow node pod was provisioned from, so that reconciles of a running
+	// hollow node can skip rebuilding it.
+	provisionedFromAnnotation = "infrastructure.cluster.x-k8s.io/kubemark-provisioned-from"
+
+	// templateNameLabel records the KubemarkMachineTemplate a hollow node pod's
+	// machine was cloned from, so that the pods of a template can be selected.
+	templateNameLabel = "infrastructure.cluster.x-k8s.io/kubemark-machine-template"
+
+	// machineNameLabel records the KubemarkMachine a hollow node pod belongs to.
+	machineNameLabel = "infrastructure.cluster.x-k8s.io/kubemark-machine"
+)
+
+// hollowNodeInput holds what is needed to build the pod of a hollow node.
+type hollowNodeInput struct {
+	kubemarkMachine *infrav1.KubemarkMachine
+	// instanceType may be nil.
+	instanceType *infrav1.KubemarkInstanceType
+	nodeName     string
+	providerID   string
+	image        string
+	// kubeconfigName is the ConfigMap holding the shared kubeconfig.
+	kubeconfigName string
+	// secretName is the Secret holding the kubelet certificate and key.
+	secretName string
+}
+
+// hollowNodePod builds the desired pod running the hollow kubelet for a
+// KubemarkMachine.
+func hollowNodePod(in *hollowNodeInput) (*v1.Pod, error) {
+	kubemarkMachine, instanceType, nodeName := in.kubemarkMachine, in.instanceType, in.nodeName
+	pod := &v1.Pod{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1.SchemeGroupVersion.String(),
+			Kind:       "Pod",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      kubemarkMachine.Name,
+			Labels:    hollowNodeLabels(kubemarkMachine),
+			Namespace: kubemarkMachine.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(kubemarkMachine, infrav1.GroupVersion.WithKind("KubemarkMachine")),
+			},
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{
+				{
+					Name:            kubemarkName,
+					Image:           in.image,
+					ImagePullPolicy: kubemarkMachine.Spec.ImagePullPolicy,
+					Args: []string{
+						"--v=3",
+						"--morph=kubelet",
+						"--log-file=/var/log/kubelet.log",
+						"--logtostderr=false",
+						fmt.Sprintf("--name=%s", nodeName),
+					},
+					Command:         []string{"/kubemark"},
+					SecurityContext: defaultSecurityContext(),
+					VolumeMounts: []v1.VolumeMount{
+						{
+							MountPath: "/kubeconfig",
+							Name:      "kubeconfig",
+						},
+						{
+							MountPath: "/var/log",
+							Name:      "logs",
+						},
+						{
+							MountPath: "/var/lib/kubelet",
+							Name:      "kubelet",
+						},
+					},
+					Resources: v1.ResourceRequirements{
+						Requests: v1.ResourceList{
+							v1.ResourceCPU:    resource.MustParse("40m"),
+							v1.ResourceMemory: resource.MustParse("10240Ki"),
+						},
+					},
+				},
+			},
+			Tolerations: []v1.Toleration{
+				{
+					Key:    "node-role.kubernetes.io/master",
+					Effect: v1.TaintEffectNoSchedule,
+				},
+			},
+			Volumes: []v1.Volume{
+				{
+					Name: "kubeconfig",
+					VolumeSource: v1.VolumeSource{
+						Projected: &v1.ProjectedVolumeSource{
+							Sources: []v1.VolumeProjection{
+								{
+									ConfigMap: &v1.ConfigMapProjection{
+										LocalObjectReference: v1.LocalObjectReference{
+											Name: in.kubeconfigName,
+										},
+									},
+								},
+								{
+									Secret: &v1.SecretProjection{
+										LocalObjectReference: v1.LocalObjectReference{
+											Name: in.secretName,
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+				{
+					Name: "logs",
+					VolumeSource: v1.VolumeSource{
+						EmptyDir: &v1.EmptyDirVolumeSource{},
+					},
+				},
+				{
+					Name: "kubelet",
+					VolumeSource: v1.VolumeSource{
+						EmptyDir: &v1.EmptyDirVolumeSource{},
+					},
+				},
+			},
+		},
+	}
+
+	if resources := extendedResources(&kubemarkMachine.Spec, instanceType); len(resources) > 0 {
+		if err := validateExtendedResources(resources); err != nil {
+			return nil, err
+		}
+		pod.Spec.Containers[0].Args = append(pod.Spec.Containers[0].Args, extendedResourcesFlag(resources))
+	}
+	nodeLabels := map[string]string{}
+	if instanceType != nil {
+		for k, v := range instanceType.Spec.Labels {
+			nodeLabels[k] = v
+		}
+		nodeLabels[v1.LabelInstanceTypeStable] = instanceType.Name
+	}
+	if arch := kubemarkMachine.Spec.Architecture; arch != "" {
+		nodeLabels[v1.LabelArchStable] = string(arch)
+		pod.Spec.Affinity = &v1.Affinity{
+			NodeAffinity: &v1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+					NodeSelectorTerms: []v1.NodeSelectorTerm{
+						{
+							MatchExpressions: []v1.NodeSelectorRequirement{
+								{
+									Key:      v1.LabelArchStable,
+									Operator: v1.NodeSelectorOpIn,
+									Values:   []string{string(arch)},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+	if kubemarkMachine.Spec.ProviderIDFormat != "" {
+		// Only set when a format is, so the pods of existing machines are not
+		// replaced.
+		pod.Spec.Containers[0].Args = append(pod.Spec.Containers[0].Args, fmt.Sprintf("--provider-id=%s", in.providerID))
+	}
+	if len(nodeLabels) > 0 {
+		pod.Spec.Containers[0].Args = append(pod.Spec.Containers[0].Args, nodeLabelsFlag(nodeLabels))
+	}
+	if kubeletConfig := kubemarkMachine.Spec.KubeletConfig; kubeletConfig != nil {
+		pod.Spec.Containers[0].Args = append(pod.Spec.Containers[0].Args, kubeletConfigFlags(kubeletConfig)...)
+	}
+
+	if templateName := kubemarkMachine.Annotations[clusterv1.TemplateClonedFromNameAnnotation]; templateName != "" {
+		pod.Labels[templateNameLabel] = templateName
+	}
+	if kubemarkMachine.Spec.SecurityContext != nil {
+		pod.Spec.Containers[0].SecurityContext = kubemarkMachine.Spec.SecurityContext.DeepCopy()
+	}
+	if kubemarkMachine.Spec.PodTemplate != nil {
+		pod.Spec.SchedulerName = kubemarkMachine.Spec.PodTemplate.SchedulerName
+		for _, constraint := range kubemarkMachine.Spec.PodTemplate.TopologySpreadConstraints {
+			constraint := *constraint.DeepCopy()
+			if constraint.LabelSelector == nil {
+				constraint.LabelSelector = &metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": kubemarkName},
+				}
+			}
+			pod.Spec.TopologySpreadConstraints = append(pod.Spec.TopologySpreadConstraints, constraint)
+		}
+		if kubemarkMachine.Spec.PodTemplate.SpreadAcrossNodes {
+			if pod.Spec.Affinity == nil {
+				pod.Spec.Affinity = &v1.Affinity{}
+			}
+			pod.Spec.Affinity.PodAntiAffinity = &v1.PodAntiAffinity{
+				PreferredDuringSchedulingIgnoredDuringExecution: []v1.WeightedPodAffinityTerm{
+					{
+						Weight: 100,
+						PodAffinityTerm: v1.PodAffinityTerm{
+							LabelSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{"app": kubemarkName},
+							},
+							TopologyKey: v1.LabelHostname,
+						},
+					},
+				},
+			}
+		}
+		if kubemarkMachine.Spec.PodTemplate.ExposeKubelet {
+			pod.Spec.Containers[0].Ports = append(pod.Spec.Containers[0].Ports, v1.ContainerPort{
+				Name:          "kubelet",
+				ContainerPort: hollowKubeletPort,
+				Protocol:      v1.ProtocolTCP,
+			})
+		}
+	}
+
+	if kubemarkMachine.Spec.PodTemplate != nil && kubemarkMachine.Spec.PodTemplate.Overlay != nil {
+		if err := applyPodOverlay(pod, kubemarkMachine.Spec.PodTemplate.Overlay.Raw); err != nil {
+			return nil, err
+		}
+	}
+
+	hash, err := podSpecHash(&pod.Spec)
+	if err != nil {
+		return nil, err
+	}
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[podSpecHashAnnotation] = hash
+
+	return pod, nil
+}
+
+// hollowKubeletPort is the port the hollow kubelet serves its API on, the
+// default of the kubemark --kubelet-port flag.
+const hollowKubeletPort = 10250
+
+// defaultSecurityContext is the profile hollow node containers run with unless
+// the KubemarkMachine overrides it. The hollow kubelet fakes its container
+// runtime and mounts, so it needs neither root nor any capabilities; the paths
+// it writes to are backed by emptyDir volumes.
+func defaultSecurityContext() *v1.SecurityContext {
+	return &v1.SecurityContext{
+		Privileged:               pointer.BoolPtr(false),
+		AllowPrivilegeEscalation: pointer.BoolPtr(false),
+		RunAsNonRoot:             pointer.BoolPtr(true),
+		RunAsUser:                pointer.Int64Ptr(65534),
+		Capabilities: &v1.Capabilities{
+			Drop: []v1.Capability{"ALL"},
+		},
+	}
+}
+
+// applyPodOverlay merges a partial PodTemplateSpec into the labels,
+// annotations and spec of a pod using strategic merge patch.
+func applyPodOverlay(pod *v1.Pod, overlay []byte) error {
+	original, err := json.Marshal(&v1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:      pod.Labels,
+			Annotations: pod.Annotations,
+		},
+		Spec: pod.Spec,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal pod template: %w", err)
+	}
+	merged, err := strategicpatch.StrategicMergePatch(original, overlay, v1.PodTemplateSpec{})
+	if err != nil {
+		return fmt.Errorf("failed to apply pod template overlay: %w", err)
+	}
+	template := &v1.PodTemplateSpec{}
+	if err := json.Unmarshal(merged, template); err != nil {
+		return fmt.Errorf("failed to unmarshal pod template: %w", err)
+	}
+	pod.Labels = template.Labels
+	pod.Annotations = template.Annotations
+	pod.Spec = template.Spec
+	return nil
+}
+
+// hollowNodeLabels returns the labels of the pod of a KubemarkMachine. Besides
+// the app label shared by all hollow nodes, they identify the machine and its
+// cluster so the pods can be selected individually.
+func hollowNodeLabels(kubemarkMachine *infrav1.KubemarkMachine) map[string]string {
+	labels := map[string]string{
+		"app":            kubemarkName,
+		machineNameLabel: kubemarkMachine.Name,
+	}
+	if clusterName := kubemarkMachine.Labels[clusterv1.ClusterLabelName]; clusterName != "" {
+		labels[clusterv1.ClusterLabelName] = clusterName
+	}
+	return labels
+}
+
+// PreviewHollowNodePod renders the pod a KubemarkMachine with the given spec
+// would run, using placeholder names for the per-machine objects. It lets
+// template changes be reviewed before they are rolled out.
+func PreviewHollowNodePod(spec infrav1.KubemarkMachineSpec, instanceType *infrav1.KubemarkInstanceType, kubemarkImage string, versionImages map[string]string, version string) (*v1.Pod, error) {
+	image, err := hollowNodeImage(&spec, kubemarkImage, versionImages, version)
+	if err != nil {
+		return nil, err
+	}
+	kubemarkMachine := &infrav1.KubemarkMachine{
+		ObjectMeta: metav1.ObjectMeta{Name: "preview"},
+		Spec:       spec,
+	}
+	return hollowNodePod(&hollowNodeInput{
+		kubemarkMachine: kubemarkMachine,
+		instanceType:    instanceType,
+		nodeName:        kubemarkMachine.Name,
+		providerID:      nodeProviderID(kubemarkMachine, nil, kubemarkMachine.Name),
+		image:           image,
+		kubeconfigName:  "preview-kubeconfig",
+		secretName:      kubemarkMachine.Name,
+	})
+}
+
+// extendedResources returns the resources a hollow node registers, taken from
+// its instance type and overridden by the ones set on the machine.
+func extendedResources(spec *infrav1.KubemarkMachineSpec, instanceType *infrav1.KubemarkInstanceType) infrav1.KubemarkExtendedResourceList {
+	resources := infrav1.KubemarkExtendedResourceList{}
+	if instanceType != nil {
+		resources = instanceType.ExtendedResources()
+	}
+	for i := range spec.VolumeAttachLimits {
+		limit := &spec.VolumeAttachLimits[i]
+		resources[limit.ResourceName()] = *resource.NewQuantity(int64(limit.Limit), resource.DecimalSI)
+	}
+	if plugin := spec.DevicePlugin; plugin != nil {
+		resources[devicePluginResource(plugin)] = *resource.NewQuantity(int64(plugin.Devices), resource.DecimalSI)
+	}
+	for name, quantity := range spec.KubemarkOptions.ExtendedResources {
+		resources[name] = quantity.DeepCopy()
+	}
+	return resources
+}
+
+// nodeLabelsFlag renders the --node-labels flag of the hollow kubelet.
+func nodeLabelsFlag(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, labels[key]))
+	}
+	return fmt.Sprintf("--node-labels=%s", strings.Join(pairs, ","))
+}
+
+// validateExtendedResources checks that the resources can be registered by a
+// hollow node. The webhook rejects invalid machines, but the resources of
+// instance types are only merged in here.
+func validateExtendedResources(resources infrav1.KubemarkExtendedResourceList) error {
+	if errs := resources.Validate(field.NewPath("extendedResources")); len(errs) > 0 {
+		return errs.ToAggregate()
+	}
+	return nil
+}
+
+// kubeletConfigFlags renders the heartbeat and feature gate flags of the
+// hollow kubelet. Unset fields are left out so that the kubemark image
+// defaults apply.
+func kubeletConfigFlags(config *infrav1.KubemarkKubeletConfig) []string {
+	var flags []string
+	if config.NodeStatusUpdateFrequency != nil {
+		flags = append(flags, fmt.Sprintf("--node-status-update-frequency=%s", config.NodeStatusUpdateFrequency.Duration))
+	}
+	if config.NodeStatusReportFrequency != nil {
+		flags = append(flags, fmt.Sprintf("--node-status-report-frequency=%s", config.NodeStatusReportFrequency.Duration))
+	}
+	if config.NodeLeaseDurationSeconds != nil {
+		flags = append(flags, fmt.Sprintf("--node-lease-duration-seconds=%d", *config.NodeLeaseDurationSeconds))
+	}
+	if len(config.FeatureGates) > 0 {
+		flags = append(flags, featureGatesFlag(config.FeatureGates))
+	}
+	return flags
+}
+
+// featureGatesFlag renders the --feature-gates flag of the hollow kubelet,
+// sorted by feature name so the pod spec stays stable.
+func featureGatesFlag(featureGates map[string]bool) string {
+	names := make([]string, 0, len(featureGates))
+	for name := range featureGates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%t", name, featureGates[name]))
+	}
+	return fmt.Sprintf("--feature-gates=%s", strings.Join(pairs, ","))
+}
+
+// extendedResourcesFlag renders the --extended-resources flag of the hollow
+// kubelet, sorted by resource name so the pod spec stays stable.
+func extendedResourcesFlag(resources infrav1.KubemarkExtendedResourceList) string {
+	names := make([]string, 0, len(resources))
+	for name := range resources {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		quantity := resources[infrav1.KubemarkExtendedResourceName(name)]
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, quantity.String()))
+	}
+	return fmt.Sprintf("--extended-resources=%s", strings.Join(pairs, ","))
+}
+
+// hollowNodeImage returns the image a KubemarkMachine runs: its own image if
+// set, then the image versionImages maps its Kubernetes version or minor
+// version to, otherwise the default kubemark image tagged with the version.
+// Machines of a non-amd64 architecture look up the variant of the version
+// suffixed with the architecture, e.g. v1.19.4-arm64.
+func hollowNodeImage(spec *infrav1.KubemarkMachineSpec, kubemarkImage string, versionImages map[string]string, version string) (string, error) {
+	if spec.Image != "" {
+		return spec.Image, nil
+	}
+	tag, minor, err := kubeletVersion(version)
+	if err != nil {
+		return "", err
+	}
+	if arch := spec.Architecture; arch != "" && arch != infrav1.KubemarkArchitectureAMD64 {
+		tag = fmt.Sprintf("%s-%s", tag, arch)
+		minor = fmt.Sprintf("%s-%s", minor, arch)
+	}
+	if image, ok := versionImages[tag]; ok {
+		return image, nil
+	}
+	if image, ok := versionImages[minor]; ok {
+		return image, nil
+	}
+	return fmt.Sprintf("%s:%s", kubemarkImage, tag), nil
+}
+
+// kubeletVersion normalizes a Machine's spec.version into the kubemark image
+// tag, and also returns its minor version. The hollow kubelet reports the
+// version it was built from, so the tag is what the Node ends up advertising.
+func kubeletVersion(version string) (string, string, error) {
+	v, err := util.ParseMajorMinorPatch(version)
+	if err != nil {
+		return "", "", err
+	}
+	return fmt.Sprintf("v%d.%d.%d", v.Major, v.Minor, v.Patch), fmt.Sprintf("v%d.%d", v.Major, v.Minor), nil
+}
+
+// podSpecHash returns a stable hash of a pod spec.
+func podSpecHash(spec *v1.PodSpec) (string, error) {
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal pod spec: %w", err)
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(b)
+	return fmt.Sprintf("%x", h.Sum32()), nil
+}
@@ -0,0 +1,588 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	infrav1 "github.com/benmoss/cluster-api-provider-kubemark/api/v1alpha4"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/cluster-api/util/secret"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// hollowNodeBackend runs a hollow kubelet for each machine in a pod of the
+// backing cluster, authenticating with a certificate signed by the cluster CA,
+// shared by the cluster through spec.sharedClientCertificate or provided
+// through spec.clientCertificateSecretRef.
+type hollowNodeBackend struct {
+	client           client.Client
+	kubemarkImage    string
+	versionImagesKey *client.ObjectKey
+	certificates     CertificateService
+	bootstrapConfig  BootstrapConfigService
+	remoteResources  RemoteResourceService
+}
+
+func (b *hollowNodeBackend) Provision(ctx context.Context, in *NodeBackendInput) (ctrl.Result, error) {
+	logger := ctrl.LoggerFrom(ctx)
+	cluster, machine, kubemarkMachine := in.Cluster, in.Machine, in.KubemarkMachine
+
+	// A running hollow node whose pod was provisioned from the current
+	// objects needs nothing rebuilt, which keeps the reconciles of a steady
+	// fleet down to a few cache reads.
+	provisioned, err := b.provisioned(ctx, in)
+	if err != nil {
+		logger.Error(err, "failed to check whether hollow node is provisioned")
+		return ctrl.Result{}, err
+	}
+	if provisioned {
+		in.Status.SetReady(kubemarkMachine, nodeProviderID(kubemarkMachine, machine, kubemarkMachine.Name))
+		_, flapNext := readinessFlap(kubemarkMachine, time.Now())
+		return ctrl.Result{RequeueAfter: flapNext}, nil
+	}
+
+	start := time.Now()
+	kubeconfig, err := b.bootstrapConfig.Kubeconfig(ctx, cluster, "/kubeconfig/cert.pem")
+	if err != nil {
+		observePhase(phaseKubeconfig, start, err)
+		logger.Error(err, "err generating certificate kubeconfig")
+		return ctrl.Result{}, err
+	}
+
+	// The kubeconfig only references the mounted certificate, so it is the
+	// same for every hollow node of the cluster and shared between them.
+	kubeconfigMap := &v1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1.SchemeGroupVersion.String(),
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      kubeconfigConfigMapName(cluster.Name),
+			Namespace: cluster.Namespace,
+			Labels: map[string]string{
+				clusterv1.ClusterLabelName: cluster.Name,
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: clusterv1.GroupVersion.String(),
+					Kind:       "Cluster",
+					Name:       cluster.Name,
+					UID:        cluster.UID,
+				},
+			},
+		},
+		Data: map[string]string{
+			"kubeconfig": string(kubeconfig),
+		},
+	}
+	// The objects are applied only when their cached copy differs, most
+	// reconciles of a running fleet have nothing to change.
+	existingMap := &v1.ConfigMap{}
+	err = b.client.Get(ctx, client.ObjectKey{Name: kubeconfigMap.Name, Namespace: kubeconfigMap.Namespace}, existingMap)
+	if err != nil && !apierrors.IsNotFound(err) {
+		logger.Error(err, "failed to get kubeconfig configmap")
+		return ctrl.Result{}, err
+	}
+	if err != nil || existingMap.Data["kubeconfig"] != kubeconfigMap.Data["kubeconfig"] || !hasAppliedMetadata(existingMap, kubeconfigMap) {
+		err = b.client.Patch(ctx, kubeconfigMap, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership)
+		observePhase(phaseKubeconfig, start, err)
+		if err != nil {
+			logger.Error(err, "failed to apply kubeconfig configmap")
+			return ctrl.Result{}, err
+		}
+	}
+
+	start = time.Now()
+	nodeName := kubemarkMachine.Name
+	var stackedCert []byte
+	existingSecret := &v1.Secret{}
+	err = b.client.Get(ctx, client.ObjectKey{Name: kubemarkMachine.Name, Namespace: kubemarkMachine.Namespace}, existingSecret)
+	if err != nil && !apierrors.IsNotFound(err) {
+		logger.Error(err, "failed to get secret")
+		return ctrl.Result{}, err
+	}
+	secretExists := err == nil
+	if ref := kubemarkMachine.Spec.ClientCertificateSecretRef; ref != nil {
+		stackedCert, err = b.providedClientCertificate(ctx, kubemarkMachine.Namespace, ref.Name)
+		if apierrors.IsNotFound(err) {
+			logger.V(4).Info("Client certificate secret is not yet available", "secret", ref.Name)
+			in.Status.SetWaiting(kubemarkMachine, infrav1.WaitingForClientCertificateReason)
+			return ctrl.Result{RequeueAfter: waitingForClientCertificateRequeueAfter}, nil
+		}
+		if err != nil {
+			logger.Error(err, "failed to get client certificate", "secret", ref.Name)
+			return ctrl.Result{}, err
+		}
+		// Credentials of another identity can be shared between machines,
+		// but the node authorizer only lets system:node:<name> act on <name>.
+		if certNodeName, err := b.certificates.NodeName(stackedCert); err == nil && certNodeName != nodeName {
+			err := fmt.Errorf("client certificate of secret %s was issued for node %s, not %s", ref.Name, certNodeName, nodeName)
+			logger.Error(err, "invalid client certificate")
+			return ctrl.Result{}, err
+		}
+	} else if kubemarkMachine.Spec.SharedClientCertificate {
+		stackedCert, err = b.sharedClientCertificate(ctx, cluster)
+		if err != nil {
+			observePhase(phaseCertificate, start, err)
+			logger.Error(err, "err getting shared kubelet certificate")
+			return ctrl.Result{}, err
+		}
+	} else {
+		// The Secret is named after the machine, so credentials it holds were
+		// issued for this node name and are kept as long as they can be read.
+		if secretExists {
+			if _, err := b.certificates.NodeName(existingSecret.Data["cert.pem"]); err == nil {
+				stackedCert = existingSecret.Data["cert.pem"]
+			} else {
+				logger.Info("unable to read existing kubelet certificate, reissuing", "reason", err.Error())
+			}
+		}
+		if stackedCert == nil {
+			stackedCert, err = b.certificates.KubeletCertificate(ctx, cluster, nodeName)
+			if err != nil {
+				observePhase(phaseCertificate, start, err)
+				logger.Error(err, "err generating kubelet certificate")
+				return ctrl.Result{}, err
+			}
+		}
+	}
+
+	ownerRef := metav1.NewControllerRef(kubemarkMachine, infrav1.GroupVersion.WithKind("KubemarkMachine"))
+	secret := &v1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1.SchemeGroupVersion.String(),
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      kubemarkMachine.Name,
+			Namespace: kubemarkMachine.Namespace,
+			Labels: map[string]string{
+				clusterv1.ClusterLabelName: cluster.Name,
+				machineNameLabel:           kubemarkMachine.Name,
+			},
+			OwnerReferences: []metav1.OwnerReference{*ownerRef},
+		},
+		Data: map[string][]byte{
+			"cert.pem": stackedCert,
+		},
+	}
+	if !secretExists || !bytes.Equal(existingSecret.Data["cert.pem"], stackedCert) || !hasAppliedMetadata(existingSecret, secret) {
+		err = b.client.Patch(ctx, secret, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership)
+		observePhase(phaseCertificate, start, err)
+		if err != nil {
+			logger.Error(err, "failed to apply secret")
+			return ctrl.Result{}, err
+		}
+	}
+
+	pod, err := b.desiredPod(ctx, in)
+	if err != nil {
+		logger.Error(err, "failed to build hollow node pod")
+		return ctrl.Result{}, err
+	}
+	// A source missing from the cache, e.g. a shared certificate Secret
+	// just created, leaves the pod without a fingerprint until the next
+	// reconcile.
+	fingerprint, err := b.provisionFingerprint(ctx, in)
+	if err != nil && !apierrors.IsNotFound(err) {
+		logger.Error(err, "failed to fingerprint hollow node inputs")
+		return ctrl.Result{}, err
+	}
+	if err == nil {
+		pod.Annotations[provisionedFromAnnotation] = fingerprint
+	}
+
+	flapDown, flapNext := readinessFlap(kubemarkMachine, time.Now())
+	if flapDown {
+		logger.V(2).Info("Stopping hollow node for readiness flap or heartbeat stall", "remaining", flapNext.String())
+		if err := b.client.Delete(ctx, &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      pod.Name,
+				Namespace: pod.Namespace,
+			},
+		}); err != nil && !apierrors.IsNotFound(err) {
+			logger.Error(err, "error deleting kubemark pod")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: flapNext}, nil
+	}
+
+	// Most of the pod spec is immutable, so a pod built from an outdated spec
+	// is deleted and recreated from the desired one.
+	existingPod := &v1.Pod{}
+	err = b.client.Get(ctx, client.ObjectKey{Name: pod.Name, Namespace: pod.Namespace}, existingPod)
+	if err != nil && !apierrors.IsNotFound(err) {
+		logger.Error(err, "failed to get pod")
+		return ctrl.Result{}, err
+	}
+	podExists := err == nil
+	if podExists && existingPod.Annotations[podSpecHashAnnotation] != pod.Annotations[podSpecHashAnnotation] {
+		if existingPod.DeletionTimestamp.IsZero() {
+			logger.Info("hollow node pod is out of date, recreating it")
+			if err := b.client.Delete(ctx, existingPod); err != nil && !apierrors.IsNotFound(err) {
+				logger.Error(err, "error deleting kubemark pod")
+				return ctrl.Result{}, err
+			}
+		}
+		// The pod watch requeues the machine once the old pod is gone.
+		return ctrl.Result{}, nil
+	}
+
+	// The spec hash covers the spec, so an existing pod carrying the same
+	// hash only needs applying if its metadata drifted.
+	if !podExists || !hasAppliedMetadata(existingPod, pod) {
+		if !podExists {
+			if result, ok := in.acceptProvision(ctx); !ok {
+				return result, nil
+			}
+		}
+		start = time.Now()
+		err = b.client.Patch(ctx, pod, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership)
+		observePhase(phasePod, start, err)
+		if err != nil {
+			logger.Error(err, "failed to apply pod")
+			return ctrl.Result{}, err
+		}
+	}
+
+	in.Status.SetReady(kubemarkMachine, nodeProviderID(kubemarkMachine, machine, nodeName))
+
+	// Come back when a readiness flap next takes the hollow node down.
+	_, flapNext = readinessFlap(kubemarkMachine, time.Now())
+	return ctrl.Result{RequeueAfter: flapNext}, nil
+}
+
+func (b *hollowNodeBackend) Delete(ctx context.Context, kubemarkMachine *infrav1.KubemarkMachine) (bool, error) {
+	logger := ctrl.LoggerFrom(ctx)
+
+	pods := &v1.PodList{}
+	if err := b.client.List(ctx, pods, client.InNamespace(kubemarkMachine.Namespace), client.MatchingLabels{machineNameLabel: kubemarkMachine.Name}); err != nil {
+		logger.Error(err, "failed to list pods")
+		return false, err
+	}
+	if len(pods.Items) > 0 {
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			if !pod.DeletionTimestamp.IsZero() {
+				continue
+			}
+			if err := b.client.Delete(ctx, pod); err != nil && !apierrors.IsNotFound(err) {
+				logger.Error(err, "error deleting kubemark pod", "pod", pod.Name)
+				return false, err
+			}
+		}
+		// The pod watch requeues the machine once the hollow kubelet stopped.
+		return false, nil
+	}
+
+	if err := b.client.Delete(ctx, &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      kubemarkMachine.Name,
+			Namespace: kubemarkMachine.Namespace,
+		},
+	}); err != nil {
+		if !apierrors.IsNotFound(err) {
+			logger.Error(err, "error deleting kubemark secret")
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// desiredPod builds the pod the hollow node of a machine should run, mounting
+// the shared kubeconfig and the certificate Secret named after the machine.
+func (b *hollowNodeBackend) desiredPod(ctx context.Context, in *NodeBackendInput) (*v1.Pod, error) {
+	logger := ctrl.LoggerFrom(ctx)
+	cluster, machine, kubemarkMachine := in.Cluster, in.Machine, in.KubemarkMachine
+
+	if machine.Spec.Version == nil {
+		err := errors.New("Machine has no spec.version")
+		logger.Error(err, "")
+		return nil, err
+	}
+	versionImages, err := b.versionImages(ctx)
+	if err != nil {
+		logger.Error(err, "error finding version image map")
+		return nil, err
+	}
+	image, err := hollowNodeImage(&kubemarkMachine.Spec, b.kubemarkImage, versionImages, *machine.Spec.Version)
+	if err != nil {
+		logger.Error(err, "invalid Machine spec.version", "version", *machine.Spec.Version)
+		return nil, err
+	}
+
+	instanceType, err := getInstanceType(ctx, b.client, kubemarkMachine)
+	if err != nil {
+		logger.Error(err, "error finding instance type", "instanceType", kubemarkMachine.Spec.InstanceType)
+		return nil, err
+	}
+
+	nodeName := kubemarkMachine.Name
+	return hollowNodePod(&hollowNodeInput{
+		kubemarkMachine: kubemarkMachine,
+		instanceType:    instanceType,
+		nodeName:        nodeName,
+		providerID:      nodeProviderID(kubemarkMachine, machine, nodeName),
+		image:           image,
+		kubeconfigName:  kubeconfigConfigMapName(cluster.Name),
+		secretName:      kubemarkMachine.Name,
+	})
+}
+
+// provisioned returns whether the hollow node of a ready machine is fully in
+// place: its pod is running from the current objects, as recorded by its
+// fingerprint, its spec hash matches the desired pod, e.g. after an upgrade
+// of the controller, and the kubeconfig and certificate it mounts exist.
+// Readiness flaps take the full path, which stops the pod.
+func (b *hollowNodeBackend) provisioned(ctx context.Context, in *NodeBackendInput) (bool, error) {
+	cluster, kubemarkMachine := in.Cluster, in.KubemarkMachine
+	if !kubemarkMachine.Status.Ready || kubemarkMachine.Spec.ProviderID == nil {
+		return false, nil
+	}
+	if flapDown, _ := readinessFlap(kubemarkMachine, time.Now()); flapDown {
+		return false, nil
+	}
+
+	pod := &v1.Pod{}
+	if err := b.client.Get(ctx, client.ObjectKey{Name: kubemarkMachine.Name, Namespace: kubemarkMachine.Namespace}, pod); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	if !pod.DeletionTimestamp.IsZero() || pod.Annotations[provisionedFromAnnotation] == "" {
+		return false, nil
+	}
+	for _, obj := range []client.Object{
+		&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: kubeconfigConfigMapName(cluster.Name), Namespace: cluster.Namespace}},
+		&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: kubemarkMachine.Name, Namespace: kubemarkMachine.Namespace}},
+	} {
+		if err := b.client.Get(ctx, client.ObjectKey{Name: obj.GetName(), Namespace: obj.GetNamespace()}, obj); err != nil {
+			return false, client.IgnoreNotFound(err)
+		}
+	}
+
+	fingerprint, err := b.provisionFingerprint(ctx, in)
+	if err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	if pod.Annotations[provisionedFromAnnotation] != fingerprint {
+		return false, nil
+	}
+
+	// The full path reports why the desired pod can't be built.
+	desired, err := b.desiredPod(ctx, in)
+	if err != nil {
+		return false, nil
+	}
+	return pod.Annotations[podSpecHashAnnotation] == desired.Annotations[podSpecHashAnnotation], nil
+}
+
+// provisionFingerprint hashes what the pod of a hollow node is built from:
+// the generation of the machine, the default image, the fields of the Machine
+// it reads, and the resource versions of the objects the kubeconfig,
+// certificate and image come from. Any change to them takes the full
+// provisioning path again.
+func (b *hollowNodeBackend) provisionFingerprint(ctx context.Context, in *NodeBackendInput) (string, error) {
+	cluster, machine, kubemarkMachine := in.Cluster, in.Machine, in.KubemarkMachine
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s/%d/%s\n", kubemarkMachine.UID, kubemarkMachine.Generation, kubemarkMachine.Annotations[clusterv1.TemplateClonedFromNameAnnotation])
+	fmt.Fprintf(h, "image=%s\n", b.kubemarkImage)
+	if machine.Spec.Version != nil {
+		fmt.Fprintf(h, "version=%s\n", *machine.Spec.Version)
+	}
+	if machine.Spec.FailureDomain != nil {
+		fmt.Fprintf(h, "failureDomain=%s\n", *machine.Spec.FailureDomain)
+	}
+
+	sources := []client.Object{
+		&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: secret.Name(cluster.Name, secret.Kubeconfig), Namespace: cluster.Namespace}},
+	}
+	if ref := kubemarkMachine.Spec.ClientCertificateSecretRef; ref != nil {
+		sources = append(sources, &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: ref.Name, Namespace: kubemarkMachine.Namespace}})
+	} else if kubemarkMachine.Spec.SharedClientCertificate {
+		sources = append(sources, &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: sharedCertificateSecretName(cluster.Name), Namespace: cluster.Namespace}})
+	}
+	if name := kubemarkMachine.Spec.InstanceType; name != "" {
+		sources = append(sources, &infrav1.KubemarkInstanceType{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	if key := b.versionImagesKey; key != nil {
+		sources = append(sources, &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}})
+	}
+	for _, source := range sources {
+		key := client.ObjectKey{Name: source.GetName(), Namespace: source.GetNamespace()}
+		if err := b.client.Get(ctx, key, source); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s=%s\n", key, source.GetResourceVersion())
+	}
+	return fmt.Sprintf("%x", h.Sum32()), nil
+}
+
+// providedClientCertificate returns the certificate and key of a
+// kubernetes.io/tls Secret, stacked in PEM form like the issued ones.
+func (b *hollowNodeBackend) providedClientCertificate(ctx context.Context, namespace, name string) ([]byte, error) {
+	tlsSecret := &v1.Secret{}
+	if err := b.client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, tlsSecret); err != nil {
+		return nil, err
+	}
+	cert, key := tlsSecret.Data[v1.TLSCertKey], tlsSecret.Data[v1.TLSPrivateKeyKey]
+	if len(cert) == 0 || len(key) == 0 {
+		return nil, fmt.Errorf("secret %s must hold %s and %s", name, v1.TLSCertKey, v1.TLSPrivateKeyKey)
+	}
+	stackedCert := append([]byte{}, cert...)
+	if !bytes.HasSuffix(stackedCert, []byte("\n")) {
+		stackedCert = append(stackedCert, '\n')
+	}
+	return append(stackedCert, key...), nil
+}
+
+// sharedClientCertificate returns the client certificate shared by the hollow
+// kubelets of a cluster. It is issued once and kept in a Secret owned by the
+// cluster, after binding its identity to the permissions of the kubelets in
+// the workload cluster.
+func (b *hollowNodeBackend) sharedClientCertificate(ctx context.Context, cluster *clusterv1.Cluster) ([]byte, error) {
+	key := client.ObjectKey{Name: sharedCertificateSecretName(cluster.Name), Namespace: cluster.Namespace}
+	sharedSecret := &v1.Secret{}
+	err := b.client.Get(ctx, key, sharedSecret)
+	if err == nil {
+		return sharedSecret.Data["cert.pem"], nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	if err := b.remoteResources.ApplyClusterRoleBinding(ctx, cluster, &rbacv1.ClusterRoleBinding{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: rbacv1.SchemeGroupVersion.String(),
+			Kind:       "ClusterRoleBinding",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: SharedKubeletUser,
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "ClusterRole",
+			Name:     "system:node",
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				APIGroup: rbacv1.GroupName,
+				Kind:     rbacv1.GroupKind,
+				Name:     SharedKubeletGroup,
+			},
+		},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to bind shared kubelet identity: %w", err)
+	}
+	stackedCert, err := b.certificates.SharedKubeletCertificate(ctx, cluster)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret = &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      key.Name,
+			Namespace: key.Namespace,
+			Labels: map[string]string{
+				clusterv1.ClusterLabelName: cluster.Name,
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: clusterv1.GroupVersion.String(),
+					Kind:       "Cluster",
+					Name:       cluster.Name,
+					UID:        cluster.UID,
+				},
+			},
+		},
+		Data: map[string][]byte{
+			"cert.pem": stackedCert,
+		},
+	}
+	// Machines provisioned concurrently may race to issue the certificate,
+	// the first one stored wins.
+	if err := b.client.Create(ctx, sharedSecret); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			return nil, err
+		}
+		if err := b.client.Get(ctx, key, sharedSecret); err != nil {
+			return nil, err
+		}
+	}
+	return sharedSecret.Data["cert.pem"], nil
+}
+
+// versionImages returns the data of the VersionImages ConfigMap. Its keys are
+// Kubernetes versions such as v1.19.1 or minor versions such as v1.19.
+func (b *hollowNodeBackend) versionImages(ctx context.Context) (map[string]string, error) {
+	if b.versionImagesKey == nil {
+		return nil, nil
+	}
+	configMap := &v1.ConfigMap{}
+	if err := b.client.Get(ctx, *b.versionImagesKey, configMap); err != nil {
+		return nil, err
+	}
+	return configMap.Data, nil
+}
+
+// hasAppliedMetadata returns whether existing carries the labels, annotations
+// and owner references desired is applied with.
+func hasAppliedMetadata(existing, desired metav1.Object) bool {
+	for key, value := range desired.GetLabels() {
+		if existingValue, ok := existing.GetLabels()[key]; !ok || existingValue != value {
+			return false
+		}
+	}
+	for key, value := range desired.GetAnnotations() {
+		if existingValue, ok := existing.GetAnnotations()[key]; !ok || existingValue != value {
+			return false
+		}
+	}
+	for _, ref := range desired.GetOwnerReferences() {
+		found := false
+		for _, existingRef := range existing.GetOwnerReferences() {
+			if existingRef.UID == ref.UID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// sharedCertificateSecretName returns the name of the Secret holding the
+// client certificate shared by the hollow kubelets of a cluster.
+func sharedCertificateSecretName(clusterName string) string {
+	return fmt.Sprintf("%s-kubemark-kubelet", clusterName)
+}
+
+// kubeconfigConfigMapName returns the name of the ConfigMap holding the
+// kubeconfig shared by the hollow nodes of a cluster.
+func kubeconfigConfigMapName(clusterName string) string {
+	return fmt.Sprintf("%s-kubemark-kubeconfig", clusterName)
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	infrav1 "github.com/benmoss/cluster-api-provider-kubemark/api/v1alpha4"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// machineClusterNameField indexes KubemarkMachines by the name of their
+	// cluster, from their cluster label.
+	machineClusterNameField = "kubemarkMachine.clusterName"
+	// machineProviderIDField indexes KubemarkMachines by spec.providerID.
+	machineProviderIDField = "kubemarkMachine.spec.providerID"
+)
+
+// IndexKubemarkMachines registers the cache indexes the controllers look
+// KubemarkMachines up with, so that the machines of a cluster or of a Node are
+// found without scanning every machine.
+func IndexKubemarkMachines(ctx context.Context, indexer client.FieldIndexer) error {
+	if err := indexer.IndexField(ctx, &infrav1.KubemarkMachine{}, machineClusterNameField, func(o client.Object) []string {
+		if clusterName := o.GetLabels()[clusterv1.ClusterLabelName]; clusterName != "" {
+			return []string{clusterName}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	return indexer.IndexField(ctx, &infrav1.KubemarkMachine{}, machineProviderIDField, func(o client.Object) []string {
+		if providerID := o.(*infrav1.KubemarkMachine).Spec.ProviderID; providerID != nil && *providerID != "" {
+			return []string{*providerID}
+		}
+		return nil
+	})
+}
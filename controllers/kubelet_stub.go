@@ -0,0 +1,124 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/cert"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// kubeletStubShutdownTimeout bounds how long the stub waits for in-flight
+// requests when the manager stops.
+const kubeletStubShutdownTimeout = 5 * time.Second
+
+// KubeletStub serves a canned subset of the kubelet API for the Nodes of the
+// node backend, which have no kubelet. kubectl logs and exec against their
+// pods then return right away rather than failing to reach a kubelet.
+type KubeletStub struct {
+	// Address is the IP the Nodes register as their internal address, one
+	// the API servers of the workload clusters reach the manager at.
+	Address string
+	// Port is the port the stub serves on and the Nodes register as their
+	// kubelet port.
+	Port int32
+}
+
+// Start serves the kubelet API with a self-signed certificate until the
+// context is done.
+func (s *KubeletStub) Start(ctx context.Context) error {
+	certPEM, keyPEM, err := cert.GenerateSelfSignedCertKey(s.Address, []net.IP{net.ParseIP(s.Address)}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to generate kubelet stub certificate: %w", err)
+	}
+	keyPair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("failed to load kubelet stub certificate: %w", err)
+	}
+	server := &http.Server{
+		Addr:      fmt.Sprintf(":%d", s.Port),
+		Handler:   kubeletStubHandler(),
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{keyPair}},
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		ctrl.Log.WithName("kubelet-stub").Info("serving kubelet API", "port", s.Port)
+		errs <- server.ListenAndServeTLS("", "")
+	}()
+	select {
+	case <-ctx.Done():
+		// The manager context is done already, give in-flight requests a
+		// moment of their own.
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), kubeletStubShutdownTimeout)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	case err := <-errs:
+		return err
+	}
+}
+
+// NeedLeaderElection is false, any replica of the manager may be the one the
+// Nodes point at.
+func (s *KubeletStub) NeedLeaderElection() bool {
+	return false
+}
+
+// kubeletStubHandler answers the kubelet API requests of the API server:
+// /pods with an empty list, /containerLogs with a line telling the pod is
+// simulated, and the streaming endpoints with an error.
+func kubeletStubHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	})
+	mux.HandleFunc("/pods", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(&v1.PodList{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: v1.SchemeGroupVersion.String(),
+				Kind:       "PodList",
+			},
+		})
+	})
+	mux.HandleFunc("/containerLogs/", func(w http.ResponseWriter, r *http.Request) {
+		// /containerLogs/<namespace>/<pod>/<container>
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/containerLogs/"), "/")
+		if len(parts) != 3 {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "kubemark: container %s of pod %s/%s runs on a simulated node and has no logs\n", parts[2], parts[0], parts[1])
+	})
+	for _, prefix := range []string{"/exec/", "/attach/", "/portForward/", "/run/"} {
+		mux.HandleFunc(prefix, func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "kubemark: pods of simulated nodes run no containers", http.StatusNotImplemented)
+		})
+	}
+	return mux
+}
@@ -0,0 +1,247 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	infrav1 "github.com/benmoss/cluster-api-provider-kubemark/api/v1alpha4"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/patch"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+)
+
+// maxChaosEvents is the number of injected failures a campaign keeps in its
+// status.
+const maxChaosEvents = 50
+
+// KubemarkChaosCampaignReconciler injects the failures of KubemarkChaosCampaigns
+// into the machines they select. It only marks the machines, the
+// KubemarkMachine reconciler carries the failures out.
+type KubemarkChaosCampaignReconciler struct {
+	client.Client
+	// Drainer lets reconciliations in flight finish when the manager stops,
+	// if set.
+	Drainer *Drainer
+}
+
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=kubemarkchaoscampaigns,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=kubemarkchaoscampaigns/status,verbs=get;update;patch
+
+func (r *KubemarkChaosCampaignReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, reterr error) {
+	logger := ctrl.LoggerFrom(ctx)
+
+	campaign := &infrav1.KubemarkChaosCampaign{}
+	if err := r.Get(ctx, req.NamespacedName, campaign); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "error finding kubemark chaos campaign")
+		return ctrl.Result{}, err
+	}
+	helper, err := patch.NewHelper(campaign, r.Client)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to init patch helper: %w", err)
+	}
+	defer func() {
+		if err := helper.Patch(ctx, campaign); err != nil && !apierrors.IsNotFound(err) {
+			logger.Error(err, "failed to patch kubemarkChaosCampaign")
+			reterr = kerrors.NewAggregate([]error{reterr, err})
+		}
+	}()
+	if !campaign.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(&campaign.Spec.Selector)
+	if err != nil {
+		logger.Error(err, "invalid selector")
+		return ctrl.Result{}, nil
+	}
+
+	now := time.Now()
+	random := rand.New(rand.NewSource(now.UnixNano()))
+	var next time.Duration
+	for _, scenario := range campaign.Spec.Scenarios {
+		if scenario.Every.Duration <= 0 {
+			logger.Info("skipping scenario without a positive interval", "scenario", scenario.Name)
+			continue
+		}
+		status := scenarioStatus(campaign, scenario.Name)
+		due := campaign.CreationTimestamp.Add(scenario.Every.Duration)
+		if status.LastInjectionTime != nil {
+			due = status.LastInjectionTime.Add(scenario.Every.Duration)
+		}
+		if now.Before(due) {
+			if remaining := due.Sub(now); next == 0 || remaining < next {
+				next = remaining
+			}
+			continue
+		}
+
+		machines := &infrav1.KubemarkMachineList{}
+		if err := r.List(ctx, machines, client.InNamespace(campaign.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			logger.Error(err, "failed to list kubemark machines")
+			return ctrl.Result{}, err
+		}
+		event, err := r.inject(ctx, campaign, scenario, eligibleMachines(machines.Items, now), now, random)
+		if err != nil {
+			logger.Error(err, "failed to inject failure", "scenario", scenario.Name)
+			return ctrl.Result{}, err
+		}
+		logger.Info("injected failure", "scenario", scenario.Name, "action", scenario.Action, "machines", len(event.Machines))
+
+		status.LastInjectionTime = &metav1.Time{Time: now}
+		status.Injections++
+		campaign.Status.Events = append(campaign.Status.Events, *event)
+		if excess := len(campaign.Status.Events) - maxChaosEvents; excess > 0 {
+			campaign.Status.Events = campaign.Status.Events[excess:]
+		}
+		if next == 0 || scenario.Every.Duration < next {
+			next = scenario.Every.Duration
+		}
+	}
+	return ctrl.Result{RequeueAfter: next}, nil
+}
+
+// inject marks the machines affected by one injection of a scenario and
+// returns the event recording it.
+func (r *KubemarkChaosCampaignReconciler) inject(ctx context.Context, campaign *infrav1.KubemarkChaosCampaign, scenario infrav1.KubemarkChaosScenario, machines []*infrav1.KubemarkMachine, now time.Time, random *rand.Rand) (*infrav1.KubemarkChaosEvent, error) {
+	event := &infrav1.KubemarkChaosEvent{
+		Time:     metav1.NewTime(now),
+		Scenario: scenario.Name,
+		Action:   scenario.Action,
+	}
+	count := 1
+	if scenario.Count != nil {
+		count = int(*scenario.Count)
+	}
+	var stalledUntil string
+	if scenario.Duration != nil {
+		stalledUntil = now.Add(scenario.Duration.Duration).UTC().Format(time.RFC3339)
+	}
+
+	var targets []*infrav1.KubemarkMachine
+	annotation, value := infrav1.KillAnnotation, campaign.Name
+	switch scenario.Action {
+	case infrav1.KubemarkChaosActionKill:
+		targets = pickMachines(machines, count, random)
+	case infrav1.KubemarkChaosActionStallHeartbeats:
+		targets = pickMachines(machines, count, random)
+		annotation, value = infrav1.HeartbeatsStalledUntilAnnotation, stalledUntil
+	case infrav1.KubemarkChaosActionPartitionZone:
+		zones := map[string][]*infrav1.KubemarkMachine{}
+		for _, kubemarkMachine := range machines {
+			machine, err := util.GetOwnerMachine(ctx, r.Client, kubemarkMachine.ObjectMeta)
+			if err != nil {
+				return nil, err
+			}
+			if machine != nil && machine.Spec.FailureDomain != nil {
+				zone := *machine.Spec.FailureDomain
+				zones[zone] = append(zones[zone], kubemarkMachine)
+			}
+		}
+		event.Zone = scenario.Zone
+		if event.Zone == "" && len(zones) > 0 {
+			names := make([]string, 0, len(zones))
+			for zone := range zones {
+				names = append(names, zone)
+			}
+			sort.Strings(names)
+			event.Zone = names[random.Intn(len(names))]
+		}
+		targets = zones[event.Zone]
+		annotation, value = infrav1.HeartbeatsStalledUntilAnnotation, stalledUntil
+	default:
+		return nil, fmt.Errorf("unknown chaos action %q", scenario.Action)
+	}
+	if annotation == infrav1.HeartbeatsStalledUntilAnnotation && value == "" {
+		return nil, fmt.Errorf("scenario %s has no duration", scenario.Name)
+	}
+
+	for _, kubemarkMachine := range targets {
+		original := kubemarkMachine.DeepCopy()
+		if kubemarkMachine.Annotations == nil {
+			kubemarkMachine.Annotations = map[string]string{}
+		}
+		kubemarkMachine.Annotations[annotation] = value
+		if err := r.Patch(ctx, kubemarkMachine, client.MergeFrom(original)); err != nil && !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		event.Machines = append(event.Machines, kubemarkMachine.Name)
+	}
+	return event, nil
+}
+
+// scenarioStatus returns the status of the named scenario, adding it if
+// missing.
+func scenarioStatus(campaign *infrav1.KubemarkChaosCampaign, name string) *infrav1.KubemarkChaosScenarioStatus {
+	for i := range campaign.Status.Scenarios {
+		if campaign.Status.Scenarios[i].Name == name {
+			return &campaign.Status.Scenarios[i]
+		}
+	}
+	campaign.Status.Scenarios = append(campaign.Status.Scenarios, infrav1.KubemarkChaosScenarioStatus{Name: name})
+	return &campaign.Status.Scenarios[len(campaign.Status.Scenarios)-1]
+}
+
+// eligibleMachines returns the machines failures can be injected into: those
+// that are running and not already failing.
+func eligibleMachines(machines []infrav1.KubemarkMachine, now time.Time) []*infrav1.KubemarkMachine {
+	var eligible []*infrav1.KubemarkMachine
+	for i := range machines {
+		kubemarkMachine := &machines[i]
+		if !kubemarkMachine.DeletionTimestamp.IsZero() || !kubemarkMachine.Status.Ready || kubemarkMachine.Status.FailureReason != nil {
+			continue
+		}
+		if _, ok := kubemarkMachine.Annotations[infrav1.KillAnnotation]; ok {
+			continue
+		}
+		if stalled, _ := heartbeatsStalled(kubemarkMachine, now); stalled {
+			continue
+		}
+		eligible = append(eligible, kubemarkMachine)
+	}
+	return eligible
+}
+
+// pickMachines returns up to count machines picked at random.
+func pickMachines(machines []*infrav1.KubemarkMachine, count int, random *rand.Rand) []*infrav1.KubemarkMachine {
+	random.Shuffle(len(machines), func(i, j int) {
+		machines[i], machines[j] = machines[j], machines[i]
+	})
+	if count > len(machines) {
+		count = len(machines)
+	}
+	return machines[:count]
+}
+
+func (r *KubemarkChaosCampaignReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager, options controller.Options) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&infrav1.KubemarkChaosCampaign{}).
+		WithOptions(options).
+		Complete(r.Drainer.wrap(r))
+}
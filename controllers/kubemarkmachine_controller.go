@@ -17,69 +17,122 @@ limitations under the License.
 package controllers
 
 import (
-	"bytes"
 	"context"
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	cryptorand "crypto/rand"
-	"crypto/x509"
-	"crypto/x509/pkix"
-	"encoding/pem"
 	"errors"
 	"fmt"
-	"math/big"
+	"net"
 	"time"
 
 	infrav1 "github.com/benmoss/cluster-api-provider-kubemark/api/v1alpha4"
-	"github.com/go-logr/logr"
 	v1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/api/resource"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	restclient "k8s.io/client-go/rest"
-	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
-	clientcmdlatest "k8s.io/client-go/tools/clientcmd/api/latest"
-	"k8s.io/client-go/util/cert"
-	"k8s.io/client-go/util/keyutil"
-	"k8s.io/utils/pointer"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/client-go/util/workqueue"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
-	"sigs.k8s.io/cluster-api/controllers/remote"
 	"sigs.k8s.io/cluster-api/util"
-	"sigs.k8s.io/cluster-api/util/certs"
+	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/conditions"
 	"sigs.k8s.io/cluster-api/util/patch"
 	"sigs.k8s.io/cluster-api/util/predicates"
-	"sigs.k8s.io/cluster-api/util/secret"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 const (
 	kubemarkName = "hollow-node"
+
+	// fieldManager is the server-side apply field manager used for the
+	// objects backing a KubemarkMachine.
+	fieldManager = "capk-controller-manager"
+
+	// The intervals after which a machine blocked on another object is
+	// checked again. The watches on those objects usually requeue it sooner,
+	// these only bound how long a missed event can stall provisioning.
+	waitingForMachineRequeueAfter           = 10 * time.Second
+	waitingForClusterRequeueAfter           = 30 * time.Second
+	waitingForInfrastructureRequeueAfter    = 30 * time.Second
+	waitingForBootstrapDataRequeueAfter     = 15 * time.Second
+	waitingForClientCertificateRequeueAfter = 15 * time.Second
+
+	// waitingForProvisionRequeueAfter is the interval after which a machine
+	// held back by the provision rate limit tries again. It is jittered so
+	// machines created at once do not all come back at once.
+	waitingForProvisionRequeueAfter = 5 * time.Second
+
+	// The backoff of the machines of a workload cluster that cannot be
+	// reached. It doubles with every failure, and is shared by the machines
+	// of the cluster so that they do not each hammer its API server.
+	unreachableBaseBackoff = 10 * time.Second
+	unreachableMaxBackoff  = 5 * time.Minute
 )
 
 // KubemarkMachineReconciler reconciles a KubemarkMachine object
 type KubemarkMachineReconciler struct {
 	client.Client
-	Log           logr.Logger
 	Scheme        *runtime.Scheme
 	KubemarkImage string
+	// VersionImages is the ConfigMap mapping Kubernetes versions to kubemark
+	// images, if any.
+	VersionImages *client.ObjectKey
+	// Provisions limits the rate at which new hollow nodes are provisioned,
+	// if set.
+	Provisions flowcontrol.RateLimiter
+	// RemoteQPS and RemoteBurst limit the requests to each workload
+	// cluster, the client-go defaults apply if unset.
+	RemoteQPS   float32
+	RemoteBurst int
+	// KubeletStub is the kubelet API the Nodes of the node backend register,
+	// if any.
+	KubeletStub *KubeletStub
+	// KubeletKeyAlgorithm is the algorithm of the keys of the kubelet
+	// certificates signed with the cluster CA. Defaults to ECDSA-P256.
+	KubeletKeyAlgorithm KubeletKeyAlgorithm
+	// ReconcileTimeout bounds each reconciliation, unbounded if unset.
+	ReconcileTimeout time.Duration
+	// Drainer lets reconciliations in flight finish when the manager stops,
+	// if set.
+	Drainer *Drainer
+	// Prober backs off from the machines of the workload clusters it finds
+	// unreachable before they try to reach them, if set.
+	Prober *ClusterProber
+
+	// The services implementing each phase of the reconciliation. Unset
+	// services are defaulted in SetupWithManager.
+	Certificates    CertificateService
+	BootstrapConfig BootstrapConfigService
+	RemoteResources RemoteResourceService
+	Status          StatusService
+
+	// Backends realize the Node of a machine by its spec.backend. The
+	// built-in backends are defaulted in SetupWithManager.
+	Backends map[infrav1.KubemarkBackend]NodeBackend
+
+	// unreachable tracks the backoff of the workload clusters that cannot be
+	// reached, by cluster UID.
+	unreachable *flowcontrol.Backoff
 }
 
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=kubemarkmachines,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=kubemarkmachines/status,verbs=get;update;patch
-// +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machines;machines/status,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=kubemarkinstancetypes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machines;machines/status,verbs=get;list;watch
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;clusters/status,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=secrets;,verbs=get;list;watch
-// +kubebuilder:rbac:groups=bootstrap.cluster.x-k8s.io,resources=kubeadmconfigs,verbs=get;list;watch
-// +kubebuilder:rbac:groups="",resources=secrets,verbs=create;delete
-// +kubebuilder:rbac:groups="",resources=pods,verbs=create;delete
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;patch
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;create;patch;delete
 
-func (r *KubemarkMachineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	logger := r.Log.WithValues("kubemarkmachine", req.NamespacedName)
+func (r *KubemarkMachineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, reterr error) {
+	logger := ctrl.LoggerFrom(ctx)
 
 	kubemarkMachine := &infrav1.KubemarkMachine{}
 	err := r.Get(ctx, req.NamespacedName, kubemarkMachine)
@@ -95,52 +148,30 @@ func (r *KubemarkMachineReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		return ctrl.Result{}, fmt.Errorf("failed to init patch helper: %w", err)
 	}
 
-	controllerutil.AddFinalizer(kubemarkMachine, infrav1.MachineFinalizer)
-	if err := helper.Patch(ctx, kubemarkMachine); err != nil {
-		logger.Error(err, "failed to add finalizer")
-		return ctrl.Result{}, err
-	}
-
+	// Always attempt to patch the object and status after each reconciliation,
+	// the Machine controller picks up spec.providerID and status.ready from here.
 	defer func() {
-		if err := helper.Patch(ctx, kubemarkMachine); err != nil {
-			if !apierrors.IsNotFound(err) {
-				logger.Error(err, "failed to patch kubemarkMachine")
-			}
+		if err := helper.Patch(ctx, kubemarkMachine); err != nil && !apierrors.IsNotFound(err) {
+			logger.Error(err, "failed to patch kubemarkMachine")
+			reterr = kerrors.NewAggregate([]error{reterr, err})
 		}
 	}()
 
 	if !kubemarkMachine.ObjectMeta.DeletionTimestamp.IsZero() {
-		logger.Info("deleting machine")
-
-		if err := r.Delete(ctx, &v1.Pod{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      kubemarkMachine.Name,
-				Namespace: kubemarkMachine.Namespace,
-			},
-		}); err != nil {
-			if !apierrors.IsNotFound(err) {
-				logger.Error(err, "error deleting kubemark pod")
-				return ctrl.Result{}, err
-			}
-		}
-		if err := r.Delete(ctx, &v1.Secret{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      kubemarkMachine.Name,
-				Namespace: kubemarkMachine.Namespace,
-			},
-		}); err != nil {
-			if !apierrors.IsNotFound(err) {
-				logger.Error(err, "error deleting kubemark configMap")
-				return ctrl.Result{}, err
-			}
-		}
-		controllerutil.RemoveFinalizer(kubemarkMachine, infrav1.MachineFinalizer)
+		return r.reconcileDelete(ctx, kubemarkMachine)
+	}
+
+	// Add the finalizer first if it does not exist, to avoid a race between
+	// creation and deletion of the backing resources.
+	if !controllerutil.ContainsFinalizer(kubemarkMachine, infrav1.MachineFinalizer) {
+		controllerutil.AddFinalizer(kubemarkMachine, infrav1.MachineFinalizer)
 		return ctrl.Result{}, nil
 	}
 
-	if kubemarkMachine.Status.Ready {
-		logger.Info("machine already ready, skipping reconcile")
-		return ctrl.Result{}, err
+	// A failed machine, e.g. an interrupted one, is not provisioned again. The
+	// Machine controller reports the failure and the machine gets replaced.
+	if kubemarkMachine.Status.FailureReason != nil {
+		return ctrl.Result{}, nil
 	}
 
 	// Fetch the Machine.
@@ -150,268 +181,335 @@ func (r *KubemarkMachineReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		return ctrl.Result{}, err
 	}
 	if machine == nil {
-		logger.Info("Machine Controller has not yet set OwnerRef")
-		return ctrl.Result{}, nil
+		logger.V(4).Info("Machine Controller has not yet set OwnerRef")
+		return ctrl.Result{RequeueAfter: waitingForMachineRequeueAfter}, nil
 	}
-	machinePatchHelper, err := patch.NewHelper(machine, r.Client)
-	if err != nil {
-		return ctrl.Result{}, fmt.Errorf("failed to init patch helper: %w", err)
-	}
-	defer func() {
-		if err := machinePatchHelper.Patch(ctx, machine); err != nil {
-			if !apierrors.IsNotFound(err) {
-				logger.Error(err, "failed to patch machine")
-			}
-		}
-	}()
-
 	logger = logger.WithValues("machine", machine.Name)
 
 	// Fetch the Cluster.
 	cluster, err := util.GetClusterFromMetadata(ctx, r.Client, machine.ObjectMeta)
 	if err != nil {
-		logger.Info("Machine is missing cluster label or cluster does not exist")
-		return ctrl.Result{}, nil
+		logger.V(4).Info("Machine is missing cluster label or cluster does not exist")
+		return ctrl.Result{RequeueAfter: waitingForClusterRequeueAfter}, nil
 	}
 	logger = logger.WithValues("cluster", cluster.Name)
-
-	restConfig, err := getRemoteCluster(ctx, logger, r.Client, cluster)
-	if err != nil {
-		logger.Error(err, "error getting remote cluster")
-		return ctrl.Result{}, err
-	}
+	ctx = ctrl.LoggerInto(ctx, logger)
 
 	if !cluster.Status.InfrastructureReady {
-		logger.Info("Cluster infrastructure is not ready yet")
-		return ctrl.Result{}, nil
+		logger.V(4).Info("Cluster infrastructure is not ready yet")
+		return ctrl.Result{RequeueAfter: waitingForInfrastructureRequeueAfter}, nil
 	}
+	// Per the bootstrap contract, only the data secret reference is relied
+	// upon, whichever bootstrap provider fills it in. The hollow kubelet gets
+	// its credentials from the cluster CA, not from the bootstrap data.
 	if machine.Spec.Bootstrap.DataSecretName == nil {
-		logger.Info("Bootstrap data secret reference is not yet available")
-		return ctrl.Result{}, nil
+		logger.V(4).Info("Bootstrap data secret reference is not yet available")
+		return ctrl.Result{RequeueAfter: waitingForBootstrapDataRequeueAfter}, nil
 	}
 
-	var caSecret v1.Secret
-	if err := r.Get(ctx, client.ObjectKey{
-		Name:      secret.Name(cluster.Name, secret.ClusterCA),
-		Namespace: cluster.Namespace,
-	}, &caSecret); err != nil {
-		logger.Error(err, "error getting cluster CA secret")
-		return ctrl.Result{}, err
+	if delay := kubemarkMachine.Spec.ProvisioningDelay; delay != nil {
+		if remaining := delay.Duration - time.Since(kubemarkMachine.CreationTimestamp.Time); remaining > 0 {
+			logger.V(4).Info("Holding machine in provisioning", "remaining", remaining.String())
+			r.Status.SetWaiting(kubemarkMachine, infrav1.WaitingForProvisioningDelayReason)
+			return ctrl.Result{RequeueAfter: remaining}, nil
+		}
 	}
 
-	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), cryptorand.Reader)
+	backend, err := r.backend(kubemarkMachine)
 	if err != nil {
-		logger.Error(err, "failed to generate private key")
+		logger.Error(err, "unknown backend")
 		return ctrl.Result{}, err
 	}
-	der, err := x509.MarshalECPrivateKey(privateKey)
-	if err != nil {
-		logger.Error(err, "failed to marshal the private key to DER")
-		return ctrl.Result{}, err
+
+	if kubemarkMachine.Spec.PowerState == infrav1.KubemarkPowerStateStopped {
+		return r.reconcileStopped(ctx, kubemarkMachine, backend)
+	}
+	// KWOK keeps its nodes running whatever the machine, so only the other
+	// backends can be taken offline.
+	if _, ok := kubemarkMachine.Annotations[infrav1.OfflineAnnotation]; ok && kubemarkMachine.Spec.Backend != infrav1.KubemarkBackendKWOK {
+		return r.reconcileStopped(ctx, kubemarkMachine, backend)
+	}
+	if campaign, ok := kubemarkMachine.Annotations[infrav1.KillAnnotation]; ok {
+		return r.reconcileInterruption(ctx, cluster, kubemarkMachine, backend,
+			fmt.Sprintf("the instance was killed by chaos campaign %s", campaign))
+	}
+	// The hollow kubelets keep retrying on their own, the other backends
+	// would each fail against the workload cluster.
+	if b := kubemarkMachine.Spec.Backend; b != "" && b != infrav1.KubemarkBackendKubemark {
+		if err := r.Prober.Unreachable(cluster); err != nil {
+			return r.reconcileUnreachable(ctx, cluster, kubemarkMachine, err), nil
+		}
+	}
+	var interruptNext time.Duration
+	if interruptAt, ok := interruptionTime(kubemarkMachine); ok {
+		interruptNext = time.Until(interruptAt)
+		if interruptNext <= 0 {
+			return r.reconcileInterruption(ctx, cluster, kubemarkMachine, backend, "the instance was interrupted")
+		}
+		if notice := kubemarkMachine.Spec.Interruption.Notice; notice != nil && notice.Duration > 0 {
+			if interruptNext <= notice.Duration {
+				err := r.RemoteResources.PatchNodeConditions(ctx, cluster, kubemarkMachine.Name, []v1.NodeCondition{
+					interruptionNotice(interruptAt, notice.Duration),
+				})
+				if isUnreachable(err) {
+					return r.reconcileUnreachable(ctx, cluster, kubemarkMachine, err), nil
+				}
+				if err != nil && !apierrors.IsNotFound(err) {
+					logger.Error(err, "failed to post interruption notice", "node", kubemarkMachine.Name)
+					return ctrl.Result{}, err
+				}
+			} else {
+				interruptNext -= notice.Duration
+			}
+		}
 	}
-	keyPEM := pem.EncodeToMemory(&pem.Block{Type: keyutil.ECPrivateKeyBlockType, Bytes: der})
 
-	caCert, err := certs.DecodeCertPEM(caSecret.Data[secret.TLSCrtDataName])
-	if err != nil {
-		logger.Error(err, "failed to decode ca certificate")
-		return ctrl.Result{}, err
+	result, err := backend.Provision(ctx, &NodeBackendInput{
+		Cluster:         cluster,
+		Machine:         machine,
+		KubemarkMachine: kubemarkMachine,
+		Status:          r.Status,
+		Provisions:      r.Provisions,
+	})
+	if isUnreachable(err) {
+		return r.reconcileUnreachable(ctx, cluster, kubemarkMachine, err), nil
 	}
-	caKey, err := certs.DecodePrivateKeyPEM(caSecret.Data[secret.TLSKeyDataName])
-	if err != nil {
-		logger.Error(err, "err decoding ca private key")
-		return ctrl.Result{}, err
+	if err == nil {
+		r.reconcileReachable(cluster, kubemarkMachine)
+	}
+	// Come back for the interruption notice or the interruption itself.
+	if err == nil && interruptNext > 0 && (result.RequeueAfter == 0 || interruptNext < result.RequeueAfter) {
+		result.RequeueAfter = interruptNext
 	}
+	return result, err
+}
 
-	now := time.Now().UTC()
-	kubeletCert := &x509.Certificate{
-		SerialNumber: new(big.Int).SetInt64(0),
-		Subject: pkix.Name{
-			CommonName:   fmt.Sprintf("system:node:%s", kubemarkMachine.Name),
-			Organization: []string{"system:nodes"},
-		},
-		NotBefore: now.Add(time.Minute * -5),
-		NotAfter:  now.Add(time.Hour * 24 * 365 * 10),
-		KeyUsage:  x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
-		ExtKeyUsage: []x509.ExtKeyUsage{
-			x509.ExtKeyUsageClientAuth,
-		},
-	}
-	certBytes, err := x509.CreateCertificate(cryptorand.Reader, kubeletCert, caCert, &privateKey.PublicKey, caKey)
-	if err != nil {
-		logger.Error(err, "err creating kubelet certificate")
-		return ctrl.Result{}, err
+// reconcileUnreachable records that the workload cluster of a machine cannot be
+// reached and returns when to try again. The first failure of a backoff window
+// doubles the backoff of the cluster, the machines failing within it all come
+// back once it is over.
+func (r *KubemarkMachineReconciler) reconcileUnreachable(ctx context.Context, cluster *clusterv1.Cluster, kubemarkMachine *infrav1.KubemarkMachine, err error) ctrl.Result {
+	id := string(cluster.UID)
+	now := r.unreachable.Clock.Now()
+	if !r.unreachable.IsInBackOffSinceUpdate(id, now) {
+		r.unreachable.Next(id, now)
+		ctrl.LoggerFrom(ctx).Info("workload cluster is unreachable, backing off", "backoff", r.unreachable.Get(id).String(), "reason", err.Error())
+	}
+	conditions.MarkFalse(kubemarkMachine, infrav1.WorkloadClusterReachableCondition, infrav1.WorkloadClusterUnreachableReason, clusterv1.ConditionSeverityWarning, err.Error())
+	return ctrl.Result{RequeueAfter: wait.Jitter(r.unreachable.Get(id), 0.1)}
+}
+
+// reconcileReachable clears the backoff of the workload cluster of a machine
+// once it could be reached again.
+func (r *KubemarkMachineReconciler) reconcileReachable(cluster *clusterv1.Cluster, kubemarkMachine *infrav1.KubemarkMachine) {
+	if conditions.IsFalse(kubemarkMachine, infrav1.WorkloadClusterReachableCondition) {
+		r.unreachable.Reset(string(cluster.UID))
+		conditions.MarkTrue(kubemarkMachine, infrav1.WorkloadClusterReachableCondition)
 	}
+}
 
-	kubeconfig, err := generateCertificateKubeconfig(restConfig, "/kubeconfig/cert.pem")
-	if err != nil {
-		logger.Error(err, "err generating certificate kubeconfig")
+// isUnreachable returns whether err is a failure to reach an API server, as
+// opposed to an error it returned.
+func isUnreachable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) || utilnet.IsConnectionRefused(err) ||
+		apierrors.IsTimeout(err) || apierrors.IsServerTimeout(err) || apierrors.IsServiceUnavailable(err)
+}
+
+// reconcileStopped stops whatever simulates the Node of a stopped machine. The
+// Node is kept and turns NotReady once its heartbeats stop. Starting the
+// machine again provisions it as usual, and the Node comes back Ready.
+func (r *KubemarkMachineReconciler) reconcileStopped(ctx context.Context, kubemarkMachine *infrav1.KubemarkMachine, backend NodeBackend) (ctrl.Result, error) {
+	logger := ctrl.LoggerFrom(ctx)
+	if deleted, err := backend.Delete(ctx, kubemarkMachine); err != nil || !deleted {
+		if err != nil {
+			logger.Error(err, "failed to stop machine")
+		}
 		return ctrl.Result{}, err
 	}
+	logger.V(4).Info("Machine is stopped")
+	r.Status.SetStopped(kubemarkMachine)
+	return ctrl.Result{}, nil
+}
 
-	stackedCert := bytes.Buffer{}
-	if err := pem.Encode(&stackedCert, &pem.Block{Type: cert.CertificateBlockType, Bytes: certBytes}); err != nil {
-		logger.Error(err, "err encoding certificate")
+// reconcileInterruption terminates an interrupted or killed machine: its
+// backend and Node are removed and the machine is marked failed with the
+// given message, so that the Machine controller reports it and a
+// MachineHealthCheck or autoscaler replaces it.
+func (r *KubemarkMachineReconciler) reconcileInterruption(ctx context.Context, cluster *clusterv1.Cluster, kubemarkMachine *infrav1.KubemarkMachine, backend NodeBackend, message string) (ctrl.Result, error) {
+	logger := ctrl.LoggerFrom(ctx)
+	logger.Info("terminating machine", "reason", message)
+
+	if deleted, err := backend.Delete(ctx, kubemarkMachine); err != nil || !deleted {
+		return ctrl.Result{}, err
+	}
+	if err := r.RemoteResources.DeleteNode(ctx, cluster, kubemarkMachine.Name); err != nil {
+		logger.Error(err, "error deleting node", "node", kubemarkMachine.Name)
 		return ctrl.Result{}, err
 	}
-	if _, err := stackedCert.Write(keyPEM); err != nil {
-		logger.Error(err, "err writing pem bytes")
+	r.Status.SetTerminated(kubemarkMachine, message)
+	return ctrl.Result{}, nil
+}
+
+func (r *KubemarkMachineReconciler) reconcileDelete(ctx context.Context, kubemarkMachine *infrav1.KubemarkMachine) (ctrl.Result, error) {
+	logger := ctrl.LoggerFrom(ctx)
+
+	// The Machine controller deletes the KubemarkMachine only once the
+	// pre-terminate hooks of the Machine are cleared, but both can be deleted
+	// at once, e.g. with their namespace. Keep the hollow node running until
+	// the hooks of a deleted Machine are done either way.
+	machine, err := util.GetOwnerMachine(ctx, r.Client, kubemarkMachine.ObjectMeta)
+	if err != nil && !apierrors.IsNotFound(err) {
+		logger.Error(err, "error finding owner machine")
 		return ctrl.Result{}, err
 	}
+	if machine != nil && !machine.DeletionTimestamp.IsZero() &&
+		annotations.HasWithPrefix(clusterv1.PreTerminateDeleteHookAnnotationPrefix, machine.Annotations) {
+		logger.V(4).Info("Waiting for pre-terminate hooks of the Machine", "machine", machine.Name)
+		r.Status.SetWaiting(kubemarkMachine, clusterv1.WaitingExternalHookReason)
+		return ctrl.Result{}, nil
+	}
 
-	secret := &v1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      kubemarkMachine.Name,
-			Namespace: kubemarkMachine.Namespace,
-		},
-		Data: map[string][]byte{
-			"kubeconfig": kubeconfig,
-			"cert.pem":   stackedCert.Bytes(),
-		},
-	}
-	if err := r.Create(ctx, secret); err != nil {
-		if !apierrors.IsAlreadyExists(err) {
-			logger.Error(err, "failed to create secret")
-			return ctrl.Result{}, err
-		}
+	logger.Info("deleting machine")
+
+	backend, err := r.backend(kubemarkMachine)
+	if err != nil {
+		logger.Error(err, "unknown backend")
+		return ctrl.Result{}, err
 	}
-	version := machine.Spec.Version
-	if version == nil {
-		err := errors.New("Machine has no spec.version")
-		logger.Error(err, "")
+	// Wait for whatever keeps the Node alive to stop before removing it, or
+	// it registers the Node again. Watches requeue the machine meanwhile.
+	if deleted, err := backend.Delete(ctx, kubemarkMachine); err != nil || !deleted {
 		return ctrl.Result{}, err
 	}
 
-	pod := &v1.Pod{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      kubemarkMachine.Name,
-			Labels:    map[string]string{"app": kubemarkName},
-			Namespace: kubemarkMachine.Namespace,
-		},
-		Spec: v1.PodSpec{
-			Containers: []v1.Container{
-				{
-					Name:  kubemarkName,
-					Image: fmt.Sprintf("%s:%s", r.KubemarkImage, *version),
-					Args: []string{
-						"--v=3",
-						"--morph=kubelet",
-						"--log-file=/var/log/kubelet.log",
-						"--logtostderr=false",
-						fmt.Sprintf("--name=%s", kubemarkMachine.Name),
-					},
-					Command: []string{"/kubemark"},
-					SecurityContext: &v1.SecurityContext{
-						Privileged: pointer.BoolPtr(true),
-					},
-					VolumeMounts: []v1.VolumeMount{
-						{
-							MountPath: "/kubeconfig",
-							Name:      "kubeconfig",
-						},
-					},
-					Resources: v1.ResourceRequirements{
-						Requests: v1.ResourceList{
-							v1.ResourceCPU:    resource.MustParse("40m"),
-							v1.ResourceMemory: resource.MustParse("10240Ki"),
-						},
-					},
-				},
-			},
-			Tolerations: []v1.Toleration{
-				{
-					Key:    "node-role.kubernetes.io/master",
-					Effect: v1.TaintEffectNoSchedule,
-				},
-			},
-			Volumes: []v1.Volume{
-				{
-					Name: "kubeconfig",
-					VolumeSource: v1.VolumeSource{
-						Secret: &v1.SecretVolumeSource{
-							SecretName: secret.Name,
-						},
-					},
-				},
-			},
-		},
-	}
-
-	if err = r.Create(ctx, pod); err != nil {
-		if !apierrors.IsAlreadyExists(err) {
-			logger.Error(err, "failed to create pod")
-			return ctrl.Result{}, err
+	if kubemarkMachine.Spec.ProviderID != nil {
+		// Remove the registered Node from the workload cluster, otherwise it
+		// lingers there as NotReady once its backend is gone.
+		cluster, err := util.GetClusterFromMetadata(ctx, r.Client, kubemarkMachine.ObjectMeta)
+		switch {
+		case err != nil:
+			logger.Info("unable to find cluster, skipping node deletion", "reason", err.Error())
+		case !cluster.DeletionTimestamp.IsZero():
+			logger.Info("cluster is being deleted, skipping node deletion")
+		default:
+			// The Node is named after the machine whatever its provider ID.
+			nodeName := kubemarkMachine.Name
+			if err := r.RemoteResources.DeleteNode(ctx, cluster, nodeName); err != nil {
+				logger.Error(err, "error deleting node", "cluster", cluster.Name, "node", nodeName)
+				return ctrl.Result{}, err
+			}
 		}
 	}
 
-	machine.Spec.ProviderID = pointer.StringPtr(fmt.Sprintf("kubemark://%s", kubemarkMachine.Name))
-	kubemarkMachine.Status.Ready = true
-
+	controllerutil.RemoveFinalizer(kubemarkMachine, infrav1.MachineFinalizer)
 	return ctrl.Result{}, nil
 }
 
-func (r *KubemarkMachineReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager) error {
-	clusterToKubemarkMachines, err := util.ClusterToObjectsMapper(mgr.GetClient(), &infrav1.KubemarkMachineList{}, mgr.GetScheme())
-	if err != nil {
-		return err
+func (r *KubemarkMachineReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager, options controller.Options) error {
+	if r.Certificates == nil {
+		r.Certificates = &clusterCACertificates{client: mgr.GetClient(), keyAlgorithm: r.KubeletKeyAlgorithm}
+	}
+	if r.BootstrapConfig == nil {
+		r.BootstrapConfig = &kubeconfigBootstrapConfig{client: mgr.GetClient()}
+	}
+	if r.RemoteResources == nil {
+		r.RemoteResources = &workloadClusterResources{client: mgr.GetClient(), qps: r.RemoteQPS, burst: r.RemoteBurst}
+	}
+	if r.Status == nil {
+		r.Status = conditionsStatus{}
 	}
+	r.unreachable = flowcontrol.NewBackOff(unreachableBaseBackoff, unreachableMaxBackoff)
+	if r.Backends == nil {
+		r.Backends = map[infrav1.KubemarkBackend]NodeBackend{}
+	}
+	if r.Backends[infrav1.KubemarkBackendKubemark] == nil {
+		r.Backends[infrav1.KubemarkBackendKubemark] = &hollowNodeBackend{
+			client:           mgr.GetClient(),
+			kubemarkImage:    r.KubemarkImage,
+			versionImagesKey: r.VersionImages,
+			certificates:     r.Certificates,
+			bootstrapConfig:  r.BootstrapConfig,
+			remoteResources:  r.RemoteResources,
+		}
+	}
+	if r.Backends[infrav1.KubemarkBackendKWOK] == nil {
+		r.Backends[infrav1.KubemarkBackendKWOK] = &kwokNodeBackend{
+			client:          mgr.GetClient(),
+			remoteResources: r.RemoteResources,
+		}
+	}
+	if r.Backends[infrav1.KubemarkBackendNode] == nil {
+		r.Backends[infrav1.KubemarkBackendNode] = &fakeNodeBackend{
+			client:          mgr.GetClient(),
+			remoteResources: r.RemoteResources,
+			kubeletStub:     r.KubeletStub,
+		}
+	}
+
 	c, err := ctrl.NewControllerManagedBy(mgr).
 		For(&infrav1.KubemarkMachine{}).
+		WithOptions(options).
+		Owns(&v1.Pod{}).
+		Owns(&v1.Secret{}).
 		Watches(
 			&source.Kind{Type: &clusterv1.Machine{}},
 			handler.EnqueueRequestsFromMapFunc(util.MachineToInfrastructureMapFunc(infrav1.GroupVersion.WithKind("KubemarkMachine"))),
 		).
-		Build(r)
+		Build(r.Drainer.wrap(withReconcileTimeout(r, r.ReconcileTimeout)))
 	if err != nil {
 		return err
 	}
+	if err := c.Watch(
+		&source.Kind{Type: &clusterv1.Cluster{}},
+		handler.Funcs{DeleteFunc: r.clusterDeleted},
+	); err != nil {
+		return err
+	}
 	return c.Watch(
 		&source.Kind{Type: &clusterv1.Cluster{}},
-		handler.EnqueueRequestsFromMapFunc(clusterToKubemarkMachines),
+		handler.EnqueueRequestsFromMapFunc(r.clusterToKubemarkMachines(ctx)),
 		predicates.ClusterUnpausedAndInfrastructureReady(ctrl.LoggerFrom(ctx)),
 	)
 }
 
-func generateCertificateKubeconfig(bootstrapClientConfig *restclient.Config, pemPath string) ([]byte, error) {
-	// Get the CA data from the bootstrap client config.
-	caFile, caData := bootstrapClientConfig.CAFile, []byte{}
-	if len(caFile) == 0 {
-		caData = bootstrapClientConfig.CAData
-	}
-
-	// Build resulting kubeconfig.
-	kubeconfigData := &clientcmdapi.Config{
-		// Define a cluster stanza based on the bootstrap kubeconfig.
-		Clusters: map[string]*clientcmdapi.Cluster{"default-cluster": {
-			Server:                   bootstrapClientConfig.Host,
-			InsecureSkipTLSVerify:    bootstrapClientConfig.Insecure,
-			CertificateAuthority:     caFile,
-			CertificateAuthorityData: caData,
-		}},
-		// Define auth based on the obtained client cert.
-		AuthInfos: map[string]*clientcmdapi.AuthInfo{"default-auth": {
-			ClientCertificate: pemPath,
-			ClientKey:         pemPath,
-		}},
-		// Define a context that connects the auth info and cluster, and set it as the default
-		Contexts: map[string]*clientcmdapi.Context{"default-context": {
-			Cluster:   "default-cluster",
-			AuthInfo:  "default-auth",
-			Namespace: "default",
-		}},
-		CurrentContext: "default-context",
-	}
-
-	// Marshal to disk
-	return runtime.Encode(clientcmdlatest.Codec, kubeconfigData)
+// clusterDeleted drops the client and the backoff kept for a deleted Cluster.
+func (r *KubemarkMachineReconciler) clusterDeleted(e event.DeleteEvent, _ workqueue.RateLimitingInterface) {
+	if forgetter, ok := r.RemoteResources.(clusterForgetter); ok {
+		forgetter.forgetCluster(e.Object.GetUID())
+	}
+	r.unreachable.Reset(string(e.Object.GetUID()))
 }
 
-func getRemoteCluster(ctx context.Context, logger logr.Logger, mgmtClient client.Reader, cluster *clusterv1.Cluster) (*restclient.Config, error) {
-	restConfig, err := remote.RESTConfig(ctx, mgmtClient, util.ObjectKey(cluster))
-	if err != nil {
-		logger.Error(err, "error getting restconfig")
-		return nil, err
+// clusterToKubemarkMachines maps a Cluster to its KubemarkMachines, looked up
+// by the cluster name index rather than by listing every machine.
+func (r *KubemarkMachineReconciler) clusterToKubemarkMachines(ctx context.Context) handler.MapFunc {
+	return func(o client.Object) []ctrl.Request {
+		machines := &infrav1.KubemarkMachineList{}
+		if err := r.List(ctx, machines, client.InNamespace(o.GetNamespace()), client.MatchingFields{machineClusterNameField: o.GetName()}); err != nil {
+			ctrl.LoggerFrom(ctx).Error(err, "failed to list kubemark machines", "cluster", o.GetName())
+			return nil
+		}
+		requests := make([]ctrl.Request, 0, len(machines.Items))
+		for _, kubemarkMachine := range machines.Items {
+			requests = append(requests, ctrl.Request{NamespacedName: client.ObjectKey{Namespace: kubemarkMachine.Namespace, Name: kubemarkMachine.Name}})
+		}
+		return requests
 	}
-	restConfig.Timeout = 30 * time.Second
+}
 
-	return restConfig, err
+// backend returns the NodeBackend of a machine, kubemark unless set otherwise.
+func (r *KubemarkMachineReconciler) backend(kubemarkMachine *infrav1.KubemarkMachine) (NodeBackend, error) {
+	name := kubemarkMachine.Spec.Backend
+	if name == "" {
+		name = infrav1.KubemarkBackendKubemark
+	}
+	backend, ok := r.Backends[name]
+	if !ok {
+		return nil, fmt.Errorf("no backend registered for %q", name)
+	}
+	return backend, nil
 }
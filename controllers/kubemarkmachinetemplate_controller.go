@@ -0,0 +1,174 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	infrav1 "github.com/benmoss/cluster-api-provider-kubemark/api/v1alpha4"
+	v1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/cluster-api/util/patch"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// KubemarkMachineTemplateReconciler reconciles a KubemarkMachineTemplate object
+type KubemarkMachineTemplateReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// Drainer lets reconciliations in flight finish when the manager stops,
+	// if set.
+	Drainer *Drainer
+}
+
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=kubemarkmachinetemplates,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=kubemarkmachinetemplates/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=kubemarkinstancetypes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;patch;delete
+
+func (r *KubemarkMachineTemplateReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, reterr error) {
+	logger := ctrl.LoggerFrom(ctx)
+
+	template := &infrav1.KubemarkMachineTemplate{}
+	if err := r.Get(ctx, req.NamespacedName, template); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "error finding kubemark machine template")
+		return ctrl.Result{}, err
+	}
+	helper, err := patch.NewHelper(template, r.Client)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to init patch helper: %w", err)
+	}
+	defer func() {
+		if err := helper.Patch(ctx, template); err != nil && !apierrors.IsNotFound(err) {
+			logger.Error(err, "failed to patch kubemarkMachineTemplate")
+			reterr = kerrors.NewAggregate([]error{reterr, err})
+		}
+	}()
+
+	var instanceType *infrav1.KubemarkInstanceType
+	if name := template.Spec.Template.Spec.InstanceType; name != "" {
+		instanceType = &infrav1.KubemarkInstanceType{}
+		if err := r.Get(ctx, client.ObjectKey{Name: name}, instanceType); err != nil {
+			logger.Error(err, "error finding instance type", "instanceType", name)
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Publish the capacity of the hollow nodes for the cluster autoscaler
+	// scale-from-zero contract.
+	template.Status.Capacity = capacityFromExtendedResources(extendedResources(&template.Spec.Template.Spec, instanceType))
+
+	if err := r.reconcilePodDisruptionBudget(ctx, template); err != nil {
+		logger.Error(err, "failed to reconcile pod disruption budget")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// reconcilePodDisruptionBudget ensures the PodDisruptionBudget covering the
+// hollow node pods of a template matches its spec.
+func (r *KubemarkMachineTemplateReconciler) reconcilePodDisruptionBudget(ctx context.Context, template *infrav1.KubemarkMachineTemplate) error {
+	budget := template.Spec.PodDisruptionBudget
+	if budget == nil {
+		existing := &policyv1beta1.PodDisruptionBudget{}
+		if err := r.Get(ctx, client.ObjectKey{Name: template.Name, Namespace: template.Namespace}, existing); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		if !metav1.IsControlledBy(existing, template) {
+			return nil
+		}
+		return client.IgnoreNotFound(r.Delete(ctx, existing))
+	}
+	pdb := &policyv1beta1.PodDisruptionBudget{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: policyv1beta1.SchemeGroupVersion.String(),
+			Kind:       "PodDisruptionBudget",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      template.Name,
+			Namespace: template.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(template, infrav1.GroupVersion.WithKind("KubemarkMachineTemplate")),
+			},
+		},
+		Spec: policyv1beta1.PodDisruptionBudgetSpec{
+			MinAvailable:   budget.MinAvailable,
+			MaxUnavailable: budget.MaxUnavailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{templateNameLabel: template.Name},
+			},
+		},
+	}
+	return r.Patch(ctx, pdb, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership)
+}
+
+func (r *KubemarkMachineTemplateReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager, options controller.Options) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&infrav1.KubemarkMachineTemplate{}).
+		WithOptions(options).
+		Owns(&policyv1beta1.PodDisruptionBudget{}).
+		Watches(
+			&source.Kind{Type: &infrav1.KubemarkInstanceType{}},
+			handler.EnqueueRequestsFromMapFunc(r.instanceTypeToTemplates(ctx)),
+		).
+		Complete(r.Drainer.wrap(r))
+}
+
+// instanceTypeToTemplates maps a KubemarkInstanceType to the templates
+// referencing it, listing them with the context of the manager.
+func (r *KubemarkMachineTemplateReconciler) instanceTypeToTemplates(ctx context.Context) handler.MapFunc {
+	return func(o client.Object) []ctrl.Request {
+		templates := &infrav1.KubemarkMachineTemplateList{}
+		if err := r.List(ctx, templates); err != nil {
+			ctrl.LoggerFrom(ctx).Error(err, "failed to list kubemark machine templates", "instanceType", o.GetName())
+			return nil
+		}
+		var requests []ctrl.Request
+		for _, template := range templates.Items {
+			if template.Spec.Template.Spec.InstanceType == o.GetName() {
+				requests = append(requests, ctrl.Request{NamespacedName: client.ObjectKey{Name: template.Name, Namespace: template.Namespace}})
+			}
+		}
+		return requests
+	}
+}
+
+// capacityFromExtendedResources converts the resources registered by a hollow
+// node to a resource list.
+func capacityFromExtendedResources(resources infrav1.KubemarkExtendedResourceList) v1.ResourceList {
+	if len(resources) == 0 {
+		return nil
+	}
+	capacity := v1.ResourceList{}
+	for name, quantity := range resources {
+		capacity[v1.ResourceName(name)] = quantity.DeepCopy()
+	}
+	return capacity
+}
@@ -0,0 +1,288 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	infrav1 "github.com/benmoss/cluster-api-provider-kubemark/api/v1alpha4"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/cluster-api/controllers/remote"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+)
+
+// KubemarkNodeReconciler mirrors the health of the workload cluster Node of a
+// KubemarkMachine into its conditions.
+type KubemarkNodeReconciler struct {
+	client.Client
+	Tracker *remote.ClusterCacheTracker
+	// ReconcileTimeout bounds each reconciliation, unbounded if unset.
+	ReconcileTimeout time.Duration
+	// Drainer lets reconciliations in flight finish when the manager stops,
+	// if set.
+	Drainer *Drainer
+	// Prober skips the machines of the workload clusters it finds
+	// unreachable, if set.
+	Prober *ClusterProber
+
+	controller controller.Controller
+	// ctx is the context of the manager. The Node watches outlive the
+	// reconciliation that starts them.
+	ctx context.Context
+}
+
+// nodePressureConditions are the Node conditions that turn NodeHealthy false.
+var nodePressureConditions = []v1.NodeConditionType{
+	v1.NodeMemoryPressure,
+	v1.NodeDiskPressure,
+	v1.NodePIDPressure,
+	v1.NodeNetworkUnavailable,
+}
+
+func (r *KubemarkNodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, reterr error) {
+	logger := ctrl.LoggerFrom(ctx)
+
+	kubemarkMachine := &infrav1.KubemarkMachine{}
+	if err := r.Get(ctx, req.NamespacedName, kubemarkMachine); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "error finding kubemark machine")
+		return ctrl.Result{}, err
+	}
+	if !kubemarkMachine.DeletionTimestamp.IsZero() || kubemarkMachine.Spec.ProviderID == nil {
+		return ctrl.Result{}, nil
+	}
+
+	cluster, err := util.GetClusterFromMetadata(ctx, r.Client, kubemarkMachine.ObjectMeta)
+	if err != nil {
+		logger.V(4).Info("KubemarkMachine is missing cluster label or cluster does not exist")
+		return ctrl.Result{}, nil
+	}
+	if annotations.IsPaused(cluster, kubemarkMachine) || !cluster.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+	logger = logger.WithValues("cluster", cluster.Name)
+	if err := r.Prober.Unreachable(cluster); err != nil {
+		// The Node cannot be read anyway, leave its conditions as they are.
+		logger.V(4).Info("Workload cluster is unreachable, skipping machine", "reason", err.Error())
+		return ctrl.Result{RequeueAfter: r.Prober.Interval}, nil
+	}
+
+	helper, err := patch.NewHelper(kubemarkMachine, r.Client)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to init patch helper: %w", err)
+	}
+	defer func() {
+		if err := helper.Patch(ctx, kubemarkMachine, patch.WithOwnedConditions{Conditions: []clusterv1.ConditionType{
+			infrav1.NodeReadyCondition,
+			infrav1.NodeHealthyCondition,
+		}}); err != nil && !apierrors.IsNotFound(err) {
+			logger.Error(err, "failed to patch kubemarkMachine")
+			reterr = kerrors.NewAggregate([]error{reterr, err})
+		}
+	}()
+
+	if err := r.watchNodes(ctx, cluster); err != nil {
+		logger.Error(err, "failed to watch nodes of the workload cluster")
+		return ctrl.Result{}, err
+	}
+	remoteClient, err := r.Tracker.GetClient(ctx, util.ObjectKey(cluster))
+	if err != nil {
+		logger.Error(err, "failed to get workload cluster client")
+		return ctrl.Result{}, err
+	}
+
+	node := &v1.Node{}
+	nodeName := kubemarkMachine.Name
+	if err := remoteClient.Get(ctx, client.ObjectKey{Name: nodeName}, node); err != nil {
+		if apierrors.IsNotFound(err) {
+			conditions.MarkFalse(kubemarkMachine, infrav1.NodeReadyCondition, infrav1.NodeNotFoundReason, clusterv1.ConditionSeverityInfo, "")
+			conditions.MarkFalse(kubemarkMachine, infrav1.NodeHealthyCondition, infrav1.NodeNotFoundReason, clusterv1.ConditionSeverityInfo, "")
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "error finding node", "node", nodeName)
+		return ctrl.Result{}, err
+	}
+
+	// Seed the custom conditions once the Node registered, whoever
+	// registered it.
+	if seeded := seededNodeConditions(kubemarkMachine, metav1.Now(), node); len(seeded) > 0 {
+		patch, err := nodeConditionsPatch(seeded)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := remoteClient.Status().Patch(ctx, node, patch, client.FieldOwner(fieldManager)); err != nil {
+			logger.Error(err, "failed to seed node conditions", "node", nodeName)
+			return ctrl.Result{}, err
+		}
+	}
+
+	if driver := kubemarkMachine.Spec.FakeCSIDriver; driver != nil {
+		if err := registerFakeCSIDriver(ctx, remoteClient, node, driver); err != nil {
+			logger.Error(err, "failed to register fake CSI driver", "node", nodeName, "driver", driver.Name)
+			return ctrl.Result{}, err
+		}
+	}
+
+	mirrorNodeConditions(kubemarkMachine, node)
+	return ctrl.Result{}, nil
+}
+
+// registerFakeCSIDriver makes the CSINode of a Node list a fake CSI driver,
+// unless it already does. The CSINode is owned by the Node, like the ones
+// kubelets create, so that it goes away with it.
+func registerFakeCSIDriver(ctx context.Context, remoteClient client.Client, node *v1.Node, driver *infrav1.KubemarkFakeCSIDriver) error {
+	desired := storagev1.CSINodeDriver{
+		Name:         driver.Name,
+		NodeID:       node.Name,
+		TopologyKeys: driver.TopologyKeys,
+	}
+	if driver.MaxVolumes != nil {
+		desired.Allocatable = &storagev1.VolumeNodeResources{Count: driver.MaxVolumes}
+	}
+
+	csiNode := &storagev1.CSINode{}
+	if err := remoteClient.Get(ctx, client.ObjectKey{Name: node.Name}, csiNode); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	for _, registered := range csiNode.Spec.Drivers {
+		if registered.Name == desired.Name && equality.Semantic.DeepEqual(registered, desired) {
+			return nil
+		}
+	}
+
+	csiNode = &storagev1.CSINode{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: storagev1.SchemeGroupVersion.String(),
+			Kind:       "CSINode",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: node.Name,
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: v1.SchemeGroupVersion.String(),
+					Kind:       "Node",
+					Name:       node.Name,
+					UID:        node.UID,
+				},
+			},
+		},
+		Spec: storagev1.CSINodeSpec{
+			Drivers: []storagev1.CSINodeDriver{desired},
+		},
+	}
+	return remoteClient.Patch(ctx, csiNode, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership)
+}
+
+// mirrorNodeConditions sets the NodeReady and NodeHealthy conditions of a
+// KubemarkMachine from the conditions of its Node.
+func mirrorNodeConditions(kubemarkMachine *infrav1.KubemarkMachine, node *v1.Node) {
+	var readyCondition *v1.NodeCondition
+	var pressures []string
+	for i := range node.Status.Conditions {
+		condition := &node.Status.Conditions[i]
+		if condition.Type == v1.NodeReady {
+			readyCondition = condition
+			continue
+		}
+		for _, pressure := range nodePressureConditions {
+			if condition.Type == pressure && condition.Status == v1.ConditionTrue {
+				pressures = append(pressures, string(condition.Type))
+			}
+		}
+	}
+
+	switch {
+	case readyCondition == nil:
+		conditions.MarkFalse(kubemarkMachine, infrav1.NodeReadyCondition, infrav1.NodeNotReadyReason, clusterv1.ConditionSeverityWarning, "Node has not reported Ready")
+	case readyCondition.Status != v1.ConditionTrue:
+		conditions.MarkFalse(kubemarkMachine, infrav1.NodeReadyCondition, infrav1.NodeNotReadyReason, clusterv1.ConditionSeverityWarning, readyCondition.Message)
+	default:
+		conditions.MarkTrue(kubemarkMachine, infrav1.NodeReadyCondition)
+	}
+
+	if len(pressures) > 0 {
+		conditions.MarkFalse(kubemarkMachine, infrav1.NodeHealthyCondition, infrav1.NodeConditionsFailedReason, clusterv1.ConditionSeverityWarning, strings.Join(pressures, ", "))
+		return
+	}
+	conditions.MarkTrue(kubemarkMachine, infrav1.NodeHealthyCondition)
+}
+
+// watchNodes starts watching the Nodes of a workload cluster, if not already
+// watching.
+func (r *KubemarkNodeReconciler) watchNodes(ctx context.Context, cluster *clusterv1.Cluster) error {
+	return r.Tracker.Watch(ctx, remote.WatchInput{
+		Name:         "kubemarknode-watchNodes",
+		Cluster:      util.ObjectKey(cluster),
+		Watcher:      r.controller,
+		Kind:         &v1.Node{},
+		EventHandler: handler.EnqueueRequestsFromMapFunc(r.nodeToKubemarkMachines(cluster.Namespace)),
+	})
+}
+
+// nodeToKubemarkMachines maps a Node to the KubemarkMachine of the namespace
+// of its cluster with its provider ID, looked up by the provider ID index.
+// Nodes whose provider ID matches no machine map to the machine they are named
+// after, as hollow nodes are.
+func (r *KubemarkNodeReconciler) nodeToKubemarkMachines(namespace string) handler.MapFunc {
+	return func(o client.Object) []ctrl.Request {
+		if node, ok := o.(*v1.Node); ok && node.Spec.ProviderID != "" {
+			machines := &infrav1.KubemarkMachineList{}
+			if err := r.List(r.ctx, machines, client.InNamespace(namespace), client.MatchingFields{machineProviderIDField: node.Spec.ProviderID}); err != nil {
+				ctrl.LoggerFrom(r.ctx).Error(err, "failed to list kubemark machines", "node", o.GetName())
+			} else if len(machines.Items) > 0 {
+				requests := make([]ctrl.Request, 0, len(machines.Items))
+				for _, kubemarkMachine := range machines.Items {
+					requests = append(requests, ctrl.Request{NamespacedName: client.ObjectKey{Namespace: kubemarkMachine.Namespace, Name: kubemarkMachine.Name}})
+				}
+				return requests
+			}
+		}
+		return []ctrl.Request{{NamespacedName: client.ObjectKey{Namespace: namespace, Name: o.GetName()}}}
+	}
+}
+
+func (r *KubemarkNodeReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager, options controller.Options) error {
+	c, err := ctrl.NewControllerManagedBy(mgr).
+		For(&infrav1.KubemarkMachine{}).
+		Named("kubemarknode").
+		WithOptions(options).
+		Build(r.Drainer.wrap(withReconcileTimeout(r, r.ReconcileTimeout)))
+	if err != nil {
+		return err
+	}
+	r.controller = c
+	r.ctx = ctx
+	return nil
+}
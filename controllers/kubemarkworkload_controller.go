@@ -0,0 +1,275 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	infrav1 "github.com/benmoss/cluster-api-provider-kubemark/api/v1alpha4"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/cluster-api/controllers/remote"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/patch"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// workloadSizeLabel is set on the pods of a KubemarkWorkload to the name
+	// of their size.
+	workloadSizeLabel = "infrastructure.cluster.x-k8s.io/kubemark-workload-size"
+
+	defaultWorkloadNamespace = "default"
+	defaultWorkloadImage     = "k8s.gcr.io/pause:3.2"
+
+	// maxWorkloadCreations is the number of pods a workload creates in one
+	// reconciliation, so that it catches up gradually after a pause.
+	maxWorkloadCreations = 100
+)
+
+// KubemarkWorkloadReconciler churns the pods of KubemarkWorkloads in their
+// workload clusters: it creates them at the rate of the workload and deletes
+// them at the end of their lifetime.
+type KubemarkWorkloadReconciler struct {
+	client.Client
+	Tracker *remote.ClusterCacheTracker
+	// ReconcileTimeout bounds each reconciliation, unbounded if unset.
+	ReconcileTimeout time.Duration
+	// Drainer lets reconciliations in flight finish when the manager stops,
+	// if set.
+	Drainer *Drainer
+}
+
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=kubemarkworkloads,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=kubemarkworkloads/status,verbs=get;update;patch
+
+func (r *KubemarkWorkloadReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, reterr error) {
+	logger := ctrl.LoggerFrom(ctx)
+
+	workload := &infrav1.KubemarkWorkload{}
+	if err := r.Get(ctx, req.NamespacedName, workload); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "error finding kubemark workload")
+		return ctrl.Result{}, err
+	}
+	helper, err := patch.NewHelper(workload, r.Client)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to init patch helper: %w", err)
+	}
+	defer func() {
+		if err := helper.Patch(ctx, workload); err != nil && !apierrors.IsNotFound(err) {
+			logger.Error(err, "failed to patch kubemarkWorkload")
+			reterr = kerrors.NewAggregate([]error{reterr, err})
+		}
+	}()
+
+	cluster, err := util.GetClusterByName(ctx, r.Client, workload.Namespace, workload.Spec.ClusterName)
+	if !workload.DeletionTimestamp.IsZero() {
+		// Without the cluster there are no pods left to delete.
+		if err == nil && cluster.DeletionTimestamp.IsZero() {
+			if err := r.deletePods(ctx, cluster, workload); err != nil {
+				logger.Error(err, "failed to delete workload pods")
+				return ctrl.Result{}, err
+			}
+		}
+		controllerutil.RemoveFinalizer(workload, infrav1.WorkloadFinalizer)
+		return ctrl.Result{}, nil
+	}
+	if !controllerutil.ContainsFinalizer(workload, infrav1.WorkloadFinalizer) {
+		controllerutil.AddFinalizer(workload, infrav1.WorkloadFinalizer)
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		logger.Info("waiting for the cluster of the workload", "cluster", workload.Spec.ClusterName, "reason", err.Error())
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
+	if annotations.IsPaused(cluster, workload) || !cluster.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+	remoteClient, err := r.Tracker.GetClient(ctx, util.ObjectKey(cluster))
+	if err != nil {
+		logger.Error(err, "failed to get workload cluster client")
+		return ctrl.Result{}, err
+	}
+
+	pods := &v1.PodList{}
+	if err := remoteClient.List(ctx, pods, client.InNamespace(workloadNamespace(workload)), client.MatchingLabels{infrav1.WorkloadLabel: workload.Name}); err != nil {
+		logger.Error(err, "failed to list workload pods")
+		return ctrl.Result{}, err
+	}
+
+	// Delete the pods at the end of their lifetime.
+	now := time.Now()
+	lifetime := workload.Spec.Lifetime.Duration
+	var live int32
+	var next time.Duration
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !pod.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if remaining := pod.CreationTimestamp.Add(lifetime).Sub(now); remaining > 0 {
+			live++
+			if next == 0 || remaining < next {
+				next = remaining
+			}
+			continue
+		}
+		if err := remoteClient.Delete(ctx, pod); err != nil && !apierrors.IsNotFound(err) {
+			logger.Error(err, "failed to delete workload pod", "pod", pod.Name)
+			return ctrl.Result{}, err
+		}
+		workload.Status.Deleted++
+	}
+
+	// Create the pods due since the last creation. The creation time
+	// advances by whole intervals, and only by those created in this
+	// reconciliation, so that the time left over and the slots beyond
+	// maxWorkloadCreations carry to the next one. Slots missed while maxPods
+	// was reached are dropped rather than made up for.
+	interval := time.Minute / time.Duration(workload.Spec.PodsPerMinute)
+	due := 1
+	created := now
+	if last := workload.Status.LastCreationTime; last != nil {
+		due = int(now.Sub(last.Time) / interval)
+		if due > maxWorkloadCreations {
+			due = maxWorkloadCreations
+		}
+		created = last.Add(time.Duration(due) * interval)
+	}
+	if due > 0 {
+		workload.Status.LastCreationTime = &metav1.Time{Time: created}
+	}
+	if maxPods := workload.Spec.MaxPods; maxPods != nil && int(*maxPods-live) < due {
+		due = int(*maxPods - live)
+	}
+	random := rand.New(rand.NewSource(now.UnixNano()))
+	for i := 0; i < due; i++ {
+		if err := remoteClient.Create(ctx, workloadPod(workload, random)); err != nil {
+			logger.Error(err, "failed to create workload pod")
+			return ctrl.Result{}, err
+		}
+		live++
+		workload.Status.Created++
+	}
+	workload.Status.Pods = live
+
+	// Come back when the next slot is due rather than a whole interval
+	// later, right away while still catching up.
+	creation := workload.Status.LastCreationTime.Add(interval).Sub(now)
+	if creation <= 0 {
+		return ctrl.Result{Requeue: true}, nil
+	}
+	if next == 0 || creation < next {
+		next = creation
+	}
+	return ctrl.Result{RequeueAfter: next}, nil
+}
+
+// deletePods removes all pods of a workload from its workload cluster.
+func (r *KubemarkWorkloadReconciler) deletePods(ctx context.Context, cluster *clusterv1.Cluster, workload *infrav1.KubemarkWorkload) error {
+	remoteClient, err := r.Tracker.GetClient(ctx, util.ObjectKey(cluster))
+	if err != nil {
+		return err
+	}
+	return remoteClient.DeleteAllOf(ctx, &v1.Pod{}, client.InNamespace(workloadNamespace(workload)), client.MatchingLabels{infrav1.WorkloadLabel: workload.Name})
+}
+
+// workloadNamespace returns the namespace of the workload cluster the pods of
+// a workload are created in.
+func workloadNamespace(workload *infrav1.KubemarkWorkload) string {
+	if workload.Spec.Namespace != "" {
+		return workload.Spec.Namespace
+	}
+	return defaultWorkloadNamespace
+}
+
+// workloadPod returns a new pod of a workload, of a size picked at random by
+// weight.
+func workloadPod(workload *infrav1.KubemarkWorkload, random *rand.Rand) *v1.Pod {
+	image := workload.Spec.Image
+	if image == "" {
+		image = defaultWorkloadImage
+	}
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: workload.Name + "-",
+			Namespace:    workloadNamespace(workload),
+			Labels: map[string]string{
+				infrav1.WorkloadLabel: workload.Name,
+			},
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{
+				{
+					Name:  "workload",
+					Image: image,
+				},
+			},
+			NodeSelector: workload.Spec.NodeSelector,
+		},
+	}
+	if size := pickWorkloadSize(workload.Spec.Sizes, random); size != nil {
+		pod.Labels[workloadSizeLabel] = size.Name
+		pod.Spec.Containers[0].Resources.Requests = size.Requests.DeepCopy()
+	}
+	return pod
+}
+
+// pickWorkloadSize returns one of the sizes picked at random by weight, or nil
+// if there are none.
+func pickWorkloadSize(sizes []infrav1.KubemarkWorkloadPodSize, random *rand.Rand) *infrav1.KubemarkWorkloadPodSize {
+	weight := func(size *infrav1.KubemarkWorkloadPodSize) int {
+		if size.Weight == nil {
+			return 1
+		}
+		return int(*size.Weight)
+	}
+	total := 0
+	for i := range sizes {
+		total += weight(&sizes[i])
+	}
+	if total == 0 {
+		return nil
+	}
+	n := random.Intn(total)
+	for i := range sizes {
+		if n -= weight(&sizes[i]); n < 0 {
+			return &sizes[i]
+		}
+	}
+	return nil
+}
+
+func (r *KubemarkWorkloadReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager, options controller.Options) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&infrav1.KubemarkWorkload{}).
+		WithOptions(options).
+		Complete(r.Drainer.wrap(withReconcileTimeout(r, r.ReconcileTimeout)))
+}
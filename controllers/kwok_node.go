@@ -0,0 +1,111 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	infrav1 "github.com/benmoss/cluster-api-provider-kubemark/api/v1alpha4"
+	v1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// kwokNodeAnnotation marks the Nodes a KWOK controller takes care of.
+	kwokNodeAnnotation = "kwok.x-k8s.io/node"
+	// kwokNodeTaintKey keeps pods that do not tolerate fake Nodes off them.
+	kwokNodeTaintKey = "kwok.x-k8s.io/node"
+)
+
+// kwokNode returns the Node registered in the workload cluster for a
+// KubemarkMachine with the kwok backend, marked for KWOK to take care of. The
+// status is only taken into account when the Node is created, KWOK maintains
+// it afterwards.
+func kwokNode(in *fakeNodeInput) (*v1.Node, error) {
+	node, err := fakeNode(in)
+	if err != nil {
+		return nil, err
+	}
+	node.Labels["type"] = "kwok"
+	node.Annotations = map[string]string{
+		kwokNodeAnnotation: "fake",
+	}
+	node.Spec.Taints = append(node.Spec.Taints, v1.Taint{
+		Key:    kwokNodeTaintKey,
+		Value:  "fake",
+		Effect: v1.TaintEffectNoSchedule,
+	})
+	return node, nil
+}
+
+// kwokNodeBackend registers the Node of a machine directly in the workload
+// cluster. There is no pod and no kubelet credentials, the KWOK controller of
+// the workload cluster keeps the Node alive.
+type kwokNodeBackend struct {
+	client          client.Client
+	remoteResources RemoteResourceService
+}
+
+func (b *kwokNodeBackend) Provision(ctx context.Context, in *NodeBackendInput) (ctrl.Result, error) {
+	logger := ctrl.LoggerFrom(ctx)
+	cluster, machine, kubemarkMachine := in.Cluster, in.Machine, in.KubemarkMachine
+
+	if machine.Spec.Version == nil {
+		err := errors.New("Machine has no spec.version")
+		logger.Error(err, "")
+		return ctrl.Result{}, err
+	}
+	instanceType, err := getInstanceType(ctx, b.client, kubemarkMachine)
+	if err != nil {
+		logger.Error(err, "error finding instance type", "instanceType", kubemarkMachine.Spec.InstanceType)
+		return ctrl.Result{}, err
+	}
+	nodeName := kubemarkMachine.Name
+	node, err := kwokNode(&fakeNodeInput{
+		kubemarkMachine: kubemarkMachine,
+		instanceType:    instanceType,
+		nodeName:        nodeName,
+		providerID:      nodeProviderID(kubemarkMachine, machine, nodeName),
+		version:         *machine.Spec.Version,
+	})
+	if err != nil {
+		logger.Error(err, "failed to build kwok node")
+		return ctrl.Result{}, err
+	}
+
+	if result, ok := in.acceptProvision(ctx); !ok {
+		return result, nil
+	}
+	start := time.Now()
+	err = b.remoteResources.ApplyNode(ctx, cluster, node)
+	observePhase(phaseNode, start, err)
+	if err != nil {
+		logger.Error(err, "failed to apply kwok node", "node", nodeName)
+		return ctrl.Result{}, err
+	}
+
+	in.Status.SetReady(kubemarkMachine, node.Spec.ProviderID)
+	return ctrl.Result{}, nil
+}
+
+// Delete has nothing to remove besides the Node, which the reconciler deletes.
+func (b *kwokNodeBackend) Delete(ctx context.Context, kubemarkMachine *infrav1.KubemarkMachine) (bool, error) {
+	return true, nil
+}
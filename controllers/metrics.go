@@ -0,0 +1,153 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	infrav1 "github.com/benmoss/cluster-api-provider-kubemark/api/v1alpha4"
+	"github.com/prometheus/client_golang/prometheus"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// The phases of provisioning a hollow node, as recorded by phaseDuration.
+const (
+	phaseKubeconfig  = "kubeconfig"
+	phaseCertificate = "certificate"
+	phasePod         = "pod"
+	phaseNode        = "node"
+)
+
+// phaseDuration tracks how long each phase of provisioning a hollow node
+// takes, so that slow provisioning at scale can be attributed to a step.
+var phaseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "capk_kubemarkmachine_phase_duration_seconds",
+	Help:    "Time spent in each phase of reconciling a KubemarkMachine, by phase and result.",
+	Buckets: prometheus.ExponentialBuckets(0.005, 2, 14),
+}, []string{"phase", "result"})
+
+func init() {
+	metrics.Registry.MustRegister(phaseDuration)
+}
+
+// observePhase records the time since start in the duration of phase.
+func observePhase(phase string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	phaseDuration.WithLabelValues(phase, result).Observe(time.Since(start).Seconds())
+}
+
+var (
+	clusterMachinesDesc = prometheus.NewDesc(
+		"capk_cluster_kubemarkmachines",
+		"Number of KubemarkMachines of a cluster.",
+		[]string{"namespace", "cluster"}, nil)
+	clusterMachinesReadyDesc = prometheus.NewDesc(
+		"capk_cluster_kubemarkmachines_ready",
+		"Number of KubemarkMachines of a cluster whose hollow node pod is running.",
+		[]string{"namespace", "cluster"}, nil)
+	clusterMachinesWaitingDesc = prometheus.NewDesc(
+		"capk_cluster_kubemarkmachines_waiting",
+		"Number of KubemarkMachines of a cluster held in provisioning, by reason.",
+		[]string{"namespace", "cluster", "reason"}, nil)
+	clusterNodesReadyDesc = prometheus.NewDesc(
+		"capk_cluster_hollow_nodes_ready",
+		"Number of hollow nodes of a cluster whose Node is Ready.",
+		[]string{"namespace", "cluster"}, nil)
+	clusterNodesUnhealthyDesc = prometheus.NewDesc(
+		"capk_cluster_hollow_nodes_unhealthy",
+		"Number of hollow nodes of a cluster whose Node reports a pressure condition or an unavailable network.",
+		[]string{"namespace", "cluster"}, nil)
+)
+
+// fleetCollector reports per cluster gauges of the KubemarkMachines in the
+// cache, so the health of simulations can be followed across clusters.
+type fleetCollector struct {
+	client client.Reader
+}
+
+// NewFleetCollector returns a collector of per cluster KubemarkMachine
+// gauges, read from c when the metrics are scraped.
+func NewFleetCollector(c client.Reader) prometheus.Collector {
+	return &fleetCollector{client: c}
+}
+
+func (c *fleetCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- clusterMachinesDesc
+	ch <- clusterMachinesReadyDesc
+	ch <- clusterMachinesWaitingDesc
+	ch <- clusterNodesReadyDesc
+	ch <- clusterNodesUnhealthyDesc
+}
+
+// clusterFleet counts the KubemarkMachines of a cluster.
+type clusterFleet struct {
+	machines, ready, nodesReady, nodesUnhealthy int
+	waiting                                     map[string]int
+}
+
+func (c *fleetCollector) Collect(ch chan<- prometheus.Metric) {
+	// Scrapes carry no context, the list is served from the cache and does
+	// not block on the API server.
+	machines := &infrav1.KubemarkMachineList{}
+	if err := c.client.List(context.Background(), machines); err != nil {
+		ctrl.Log.Error(err, "failed to list kubemark machines for metrics")
+		return
+	}
+
+	type clusterKey struct{ namespace, name string }
+	fleets := map[clusterKey]*clusterFleet{}
+	for i := range machines.Items {
+		kubemarkMachine := &machines.Items[i]
+		key := clusterKey{kubemarkMachine.Namespace, kubemarkMachine.Labels[clusterv1.ClusterLabelName]}
+		fleet, ok := fleets[key]
+		if !ok {
+			fleet = &clusterFleet{waiting: map[string]int{}}
+			fleets[key] = fleet
+		}
+		fleet.machines++
+		if kubemarkMachine.Status.Ready {
+			fleet.ready++
+		} else if conditions.IsFalse(kubemarkMachine, infrav1.InstanceReadyCondition) {
+			fleet.waiting[conditions.GetReason(kubemarkMachine, infrav1.InstanceReadyCondition)]++
+		}
+		if conditions.IsTrue(kubemarkMachine, infrav1.NodeReadyCondition) {
+			fleet.nodesReady++
+		}
+		if conditions.IsFalse(kubemarkMachine, infrav1.NodeHealthyCondition) &&
+			conditions.GetReason(kubemarkMachine, infrav1.NodeHealthyCondition) == infrav1.NodeConditionsFailedReason {
+			fleet.nodesUnhealthy++
+		}
+	}
+
+	for key, fleet := range fleets {
+		ch <- prometheus.MustNewConstMetric(clusterMachinesDesc, prometheus.GaugeValue, float64(fleet.machines), key.namespace, key.name)
+		ch <- prometheus.MustNewConstMetric(clusterMachinesReadyDesc, prometheus.GaugeValue, float64(fleet.ready), key.namespace, key.name)
+		ch <- prometheus.MustNewConstMetric(clusterNodesReadyDesc, prometheus.GaugeValue, float64(fleet.nodesReady), key.namespace, key.name)
+		ch <- prometheus.MustNewConstMetric(clusterNodesUnhealthyDesc, prometheus.GaugeValue, float64(fleet.nodesUnhealthy), key.namespace, key.name)
+		for reason, count := range fleet.waiting {
+			ch <- prometheus.MustNewConstMetric(clusterMachinesWaitingDesc, prometheus.GaugeValue, float64(count), key.namespace, key.name, reason)
+		}
+	}
+}
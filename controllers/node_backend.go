@@ -0,0 +1,106 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	infrav1 "github.com/benmoss/cluster-api-provider-kubemark/api/v1alpha4"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/flowcontrol"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// NodeBackend realizes the Node of a KubemarkMachine, e.g. with a hollow
+// kubelet or as a fake Node. The reconciler takes care of everything shared
+// between backends: waiting for the Machine and Cluster, the provisioning
+// delay, deletion hooks and removing the Node. The backends take a token of
+// the provision rate limit through the input before creating anything.
+type NodeBackend interface {
+	// Provision creates or updates whatever simulates the Node of a machine
+	// and records its progress through the Status of the input. It sets
+	// spec.providerID once the Node is on its way.
+	Provision(ctx context.Context, in *NodeBackendInput) (ctrl.Result, error)
+	// Delete removes whatever simulates the Node of a machine, except the
+	// Node itself. It returns false while that is still going away, the
+	// machine is reconciled again once it is gone.
+	Delete(ctx context.Context, kubemarkMachine *infrav1.KubemarkMachine) (bool, error)
+}
+
+// NodeBackendInput is the machine a NodeBackend provisions, with its owners.
+type NodeBackendInput struct {
+	Cluster         *clusterv1.Cluster
+	Machine         *clusterv1.Machine
+	KubemarkMachine *infrav1.KubemarkMachine
+	Status          StatusService
+	// Provisions limits the rate at which machines that were never
+	// provisioned create their pod or Node, if set.
+	Provisions flowcontrol.RateLimiter
+}
+
+// acceptProvision takes a token of the provision rate limit for a machine that
+// was never provisioned, right before its backend creates its pod or Node.
+// When none is left, it holds the machine in provisioning and returns false
+// with the result to return. Machines that were provisioned take no token.
+func (in *NodeBackendInput) acceptProvision(ctx context.Context) (ctrl.Result, bool) {
+	if in.KubemarkMachine.Spec.ProviderID != nil || in.Provisions == nil || in.Provisions.TryAccept() {
+		return ctrl.Result{}, true
+	}
+	ctrl.LoggerFrom(ctx).V(4).Info("Provision rate limit reached, holding machine in provisioning")
+	in.Status.SetWaiting(in.KubemarkMachine, infrav1.WaitingForProvisionRateLimitReason)
+	return ctrl.Result{RequeueAfter: wait.Jitter(waitingForProvisionRequeueAfter, 1.0)}, false
+}
+
+// defaultProviderIDZone is the {{zone}} of the provider ID of a machine whose
+// Machine has no failure domain.
+const defaultProviderIDZone = "kubemark"
+
+// nodeProviderID returns the provider ID of the Node of a machine, following
+// its providerIDFormat.
+func nodeProviderID(kubemarkMachine *infrav1.KubemarkMachine, machine *clusterv1.Machine, nodeName string) string {
+	zone := defaultProviderIDZone
+	if machine != nil && machine.Spec.FailureDomain != nil && *machine.Spec.FailureDomain != "" {
+		zone = *machine.Spec.FailureDomain
+	}
+	// A stable ID in the shape of an EC2 instance ID.
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(kubemarkMachine.UID))
+	id := fmt.Sprintf("i-%017x", h.Sum64())
+	return strings.NewReplacer(
+		"{{name}}", nodeName,
+		"{{namespace}}", kubemarkMachine.Namespace,
+		"{{zone}}", zone,
+		"{{id}}", id,
+	).Replace(kubemarkMachine.Spec.ProviderIDFormat.Template())
+}
+
+// getInstanceType returns the KubemarkInstanceType of a machine, if it has one.
+func getInstanceType(ctx context.Context, c client.Reader, kubemarkMachine *infrav1.KubemarkMachine) (*infrav1.KubemarkInstanceType, error) {
+	if kubemarkMachine.Spec.InstanceType == "" {
+		return nil, nil
+	}
+	instanceType := &infrav1.KubemarkInstanceType{}
+	if err := c.Get(ctx, client.ObjectKey{Name: kubemarkMachine.Spec.InstanceType}, instanceType); err != nil {
+		return nil, err
+	}
+	return instanceType, nil
+}
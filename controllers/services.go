@@ -0,0 +1,546 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	infrav1 "github.com/benmoss/cluster-api-provider-kubemark/api/v1alpha4"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	restclient "k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	clientcmdlatest "k8s.io/client-go/tools/clientcmd/api/latest"
+	"k8s.io/client-go/util/cert"
+	"k8s.io/client-go/util/keyutil"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/cluster-api/controllers/remote"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/certs"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/secret"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// CertificateService issues the client credentials of hollow kubelets.
+type CertificateService interface {
+	// KubeletCertificate returns a kubelet client certificate for nodeName,
+	// stacked with its private key in PEM form.
+	KubeletCertificate(ctx context.Context, cluster *clusterv1.Cluster, nodeName string) ([]byte, error)
+	// SharedKubeletCertificate returns a client certificate for the identity
+	// shared by the hollow kubelets of spec.sharedClientCertificate, stacked
+	// with its private key in PEM form.
+	SharedKubeletCertificate(ctx context.Context, cluster *clusterv1.Cluster) ([]byte, error)
+	// NodeName returns the node name a stacked certificate was issued for.
+	NodeName(stackedCert []byte) (string, error)
+}
+
+// BootstrapConfigService renders the configuration hollow kubelets use to
+// join a workload cluster.
+type BootstrapConfigService interface {
+	// Kubeconfig returns a kubeconfig for the workload cluster that
+	// authenticates with the certificate at pemPath.
+	Kubeconfig(ctx context.Context, cluster *clusterv1.Cluster, pemPath string) ([]byte, error)
+}
+
+// RemoteResourceService manages objects in the workload cluster.
+type RemoteResourceService interface {
+	// ApplyNode creates or updates a Node in the workload cluster.
+	ApplyNode(ctx context.Context, cluster *clusterv1.Cluster, node *v1.Node) error
+	// PatchNodeConditions updates the given conditions of the named Node,
+	// leaving its other conditions alone.
+	PatchNodeConditions(ctx context.Context, cluster *clusterv1.Cluster, nodeName string, nodeConditions []v1.NodeCondition) error
+	// PatchNodeAllocatable updates the given allocatable resources of the
+	// named Node, leaving its other resources alone.
+	PatchNodeAllocatable(ctx context.Context, cluster *clusterv1.Cluster, nodeName string, allocatable v1.ResourceList) error
+	// ApplyNodeLease creates or renews a Lease of the kube-node-lease
+	// namespace in the workload cluster.
+	ApplyNodeLease(ctx context.Context, cluster *clusterv1.Cluster, lease *coordinationv1.Lease) error
+	// DeleteNode removes the named Node and its Lease from the workload
+	// cluster, if present.
+	DeleteNode(ctx context.Context, cluster *clusterv1.Cluster, nodeName string) error
+	// ApplyClusterRoleBinding creates or updates a ClusterRoleBinding in the
+	// workload cluster.
+	ApplyClusterRoleBinding(ctx context.Context, cluster *clusterv1.Cluster, binding *rbacv1.ClusterRoleBinding) error
+}
+
+// clusterForgetter is implemented by the services that keep state for each
+// workload cluster, so that it is dropped once the Cluster is deleted.
+type clusterForgetter interface {
+	forgetCluster(uid types.UID)
+}
+
+// StatusService records the provisioning state of a KubemarkMachine.
+type StatusService interface {
+	// SetWaiting records that provisioning is blocked for the given reason.
+	SetWaiting(kubemarkMachine *infrav1.KubemarkMachine, reason string)
+	// SetReady records that the Node with the given provider ID is running.
+	SetReady(kubemarkMachine *infrav1.KubemarkMachine, providerID string)
+	// SetStopped records that the machine was stopped on purpose.
+	SetStopped(kubemarkMachine *infrav1.KubemarkMachine)
+	// SetTerminated records that the machine is gone for good, with a
+	// message telling why.
+	SetTerminated(kubemarkMachine *infrav1.KubemarkMachine, message string)
+}
+
+// KubeletKeyAlgorithm is the algorithm of the private keys of the kubelet
+// certificates signed with the cluster CA.
+type KubeletKeyAlgorithm string
+
+// The algorithms of kubelet keys, named after the key type and its curve or
+// size.
+const (
+	KubeletKeyECDSAP256 KubeletKeyAlgorithm = "ECDSA-P256"
+	KubeletKeyECDSAP384 KubeletKeyAlgorithm = "ECDSA-P384"
+	KubeletKeyRSA2048   KubeletKeyAlgorithm = "RSA-2048"
+	KubeletKeyRSA3072   KubeletKeyAlgorithm = "RSA-3072"
+	KubeletKeyRSA4096   KubeletKeyAlgorithm = "RSA-4096"
+)
+
+// KubeletKeyAlgorithms are the supported kubelet key algorithms. ECDSA keys
+// are much cheaper to generate than RSA ones when creating thousands of
+// nodes.
+var KubeletKeyAlgorithms = []KubeletKeyAlgorithm{
+	KubeletKeyECDSAP256,
+	KubeletKeyECDSAP384,
+	KubeletKeyRSA2048,
+	KubeletKeyRSA3072,
+	KubeletKeyRSA4096,
+}
+
+// generateKey returns a new private key of the algorithm and its PEM
+// encoding.
+func (a KubeletKeyAlgorithm) generateKey() (crypto.Signer, []byte, error) {
+	switch a {
+	case KubeletKeyECDSAP256, KubeletKeyECDSAP384, "":
+		curve := elliptic.P256()
+		if a == KubeletKeyECDSAP384 {
+			curve = elliptic.P384()
+		}
+		privateKey, err := ecdsa.GenerateKey(curve, cryptorand.Reader)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to generate private key: %w", err)
+		}
+		der, err := x509.MarshalECPrivateKey(privateKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal the private key to DER: %w", err)
+		}
+		return privateKey, pem.EncodeToMemory(&pem.Block{Type: keyutil.ECPrivateKeyBlockType, Bytes: der}), nil
+	case KubeletKeyRSA2048, KubeletKeyRSA3072, KubeletKeyRSA4096:
+		bits := map[KubeletKeyAlgorithm]int{
+			KubeletKeyRSA2048: 2048,
+			KubeletKeyRSA3072: 3072,
+			KubeletKeyRSA4096: 4096,
+		}[a]
+		privateKey, err := rsa.GenerateKey(cryptorand.Reader, bits)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to generate private key: %w", err)
+		}
+		der := x509.MarshalPKCS1PrivateKey(privateKey)
+		return privateKey, pem.EncodeToMemory(&pem.Block{Type: keyutil.RSAPrivateKeyBlockType, Bytes: der}), nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported key algorithm %q", a)
+	}
+}
+
+// SharedKubeletUser and SharedKubeletGroup are the identity of the hollow
+// kubelets sharing a client certificate. It is not a node identity, so the
+// node authorizer and the NodeRestriction admission plugin leave it alone and
+// RBAC grants it the permissions of the kubelets instead.
+const (
+	SharedKubeletUser  = "kubemark:hollow-kubelet"
+	SharedKubeletGroup = "kubemark:hollow-kubelets"
+)
+
+// clusterCACertificates signs kubelet certificates with the cluster CA.
+type clusterCACertificates struct {
+	client       client.Client
+	keyAlgorithm KubeletKeyAlgorithm
+}
+
+func (s *clusterCACertificates) KubeletCertificate(ctx context.Context, cluster *clusterv1.Cluster, nodeName string) ([]byte, error) {
+	return s.clientCertificate(ctx, cluster, pkix.Name{
+		CommonName:   fmt.Sprintf("system:node:%s", nodeName),
+		Organization: []string{"system:nodes"},
+	})
+}
+
+func (s *clusterCACertificates) SharedKubeletCertificate(ctx context.Context, cluster *clusterv1.Cluster) ([]byte, error) {
+	return s.clientCertificate(ctx, cluster, pkix.Name{
+		CommonName:   SharedKubeletUser,
+		Organization: []string{SharedKubeletGroup},
+	})
+}
+
+// clientCertificate signs a client certificate for subject with the cluster
+// CA and stacks it with its private key.
+func (s *clusterCACertificates) clientCertificate(ctx context.Context, cluster *clusterv1.Cluster, subject pkix.Name) ([]byte, error) {
+	var caSecret v1.Secret
+	if err := s.client.Get(ctx, client.ObjectKey{
+		Name:      secret.Name(cluster.Name, secret.ClusterCA),
+		Namespace: cluster.Namespace,
+	}, &caSecret); err != nil {
+		return nil, fmt.Errorf("error getting cluster CA secret: %w", err)
+	}
+
+	privateKey, keyPEM, err := s.keyAlgorithm.generateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	caCert, err := certs.DecodeCertPEM(caSecret.Data[secret.TLSCrtDataName])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ca certificate: %w", err)
+	}
+	caKey, err := certs.DecodePrivateKeyPEM(caSecret.Data[secret.TLSKeyDataName])
+	if err != nil {
+		return nil, fmt.Errorf("err decoding ca private key: %w", err)
+	}
+
+	now := time.Now().UTC()
+	kubeletCert := &x509.Certificate{
+		SerialNumber: new(big.Int).SetInt64(0),
+		Subject:      subject,
+		NotBefore:    now.Add(time.Minute * -5),
+		NotAfter:     now.Add(time.Hour * 24 * 365 * 10),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageClientAuth,
+		},
+	}
+	certBytes, err := x509.CreateCertificate(cryptorand.Reader, kubeletCert, caCert, privateKey.Public(), caKey)
+	if err != nil {
+		return nil, fmt.Errorf("err creating kubelet certificate: %w", err)
+	}
+
+	stackedCert := bytes.Buffer{}
+	if err := pem.Encode(&stackedCert, &pem.Block{Type: cert.CertificateBlockType, Bytes: certBytes}); err != nil {
+		return nil, fmt.Errorf("err encoding certificate: %w", err)
+	}
+	if _, err := stackedCert.Write(keyPEM); err != nil {
+		return nil, fmt.Errorf("err writing pem bytes: %w", err)
+	}
+	return stackedCert.Bytes(), nil
+}
+
+// NodeName reads the node name from the system:node:<name> common name.
+func (s *clusterCACertificates) NodeName(stackedCert []byte) (string, error) {
+	kubeletCert, err := certs.DecodeCertPEM(stackedCert)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(kubeletCert.Subject.CommonName, "system:node:") {
+		return "", fmt.Errorf("unexpected common name %q", kubeletCert.Subject.CommonName)
+	}
+	return strings.TrimPrefix(kubeletCert.Subject.CommonName, "system:node:"), nil
+}
+
+// kubeconfigBootstrapConfig derives the hollow kubelet kubeconfig from the
+// admin kubeconfig of the workload cluster.
+type kubeconfigBootstrapConfig struct {
+	client client.Client
+}
+
+func (s *kubeconfigBootstrapConfig) Kubeconfig(ctx context.Context, cluster *clusterv1.Cluster, pemPath string) ([]byte, error) {
+	restConfig, err := remote.RESTConfig(ctx, s.client, util.ObjectKey(cluster))
+	if err != nil {
+		return nil, fmt.Errorf("error getting restconfig: %w", err)
+	}
+	return generateCertificateKubeconfig(restConfig, pemPath)
+}
+
+func generateCertificateKubeconfig(bootstrapClientConfig *restclient.Config, pemPath string) ([]byte, error) {
+	// Get the CA data from the bootstrap client config.
+	caFile, caData := bootstrapClientConfig.CAFile, []byte{}
+	if len(caFile) == 0 {
+		caData = bootstrapClientConfig.CAData
+	}
+
+	// Build resulting kubeconfig.
+	kubeconfigData := &clientcmdapi.Config{
+		// Define a cluster stanza based on the bootstrap kubeconfig.
+		Clusters: map[string]*clientcmdapi.Cluster{"default-cluster": {
+			Server:                   bootstrapClientConfig.Host,
+			InsecureSkipTLSVerify:    bootstrapClientConfig.Insecure,
+			CertificateAuthority:     caFile,
+			CertificateAuthorityData: caData,
+		}},
+		// Define auth based on the obtained client cert.
+		AuthInfos: map[string]*clientcmdapi.AuthInfo{"default-auth": {
+			ClientCertificate: pemPath,
+			ClientKey:         pemPath,
+		}},
+		// Define a context that connects the auth info and cluster, and set it as the default
+		Contexts: map[string]*clientcmdapi.Context{"default-context": {
+			Cluster:   "default-cluster",
+			AuthInfo:  "default-auth",
+			Namespace: "default",
+		}},
+		CurrentContext: "default-context",
+	}
+
+	// Marshal to disk
+	return runtime.Encode(clientcmdlatest.Codec, kubeconfigData)
+}
+
+// remoteClientTimeout bounds each request to a workload cluster.
+const remoteClientTimeout = 30 * time.Second
+
+// workloadClusterResources reaches the workload cluster through its admin
+// kubeconfig, within the QPS and burst of its client, if set. The client of
+// each cluster is kept, so that its rate limit is shared between machines and
+// frequent requests such as heartbeats do not rebuild it every time, until the
+// Cluster is deleted.
+type workloadClusterResources struct {
+	client client.Client
+	qps    float32
+	burst  int
+
+	lock    sync.Mutex
+	clients map[types.UID]client.Client
+}
+
+func (s *workloadClusterResources) remoteClient(ctx context.Context, cluster *clusterv1.Cluster) (client.Client, error) {
+	s.lock.Lock()
+	remoteClient, ok := s.clients[cluster.UID]
+	s.lock.Unlock()
+	if ok {
+		return remoteClient, nil
+	}
+
+	// The client is built without holding the lock, so that a cluster that
+	// is slow to answer does not hold up the machines of the others. The
+	// lazy RESTMapper defers discovery to the first request, which is bound
+	// by the timeout of the client.
+	restConfig, err := remote.RESTConfig(ctx, s.client, util.ObjectKey(cluster))
+	if err != nil {
+		return nil, err
+	}
+	restConfig.Timeout = remoteClientTimeout
+	// Only built-in kinds are written to workload clusters, protobuf cuts the
+	// cost of encoding the Nodes at scale.
+	restConfig.ContentType = runtime.ContentTypeProtobuf
+	restConfig.AcceptContentTypes = strings.Join([]string{runtime.ContentTypeProtobuf, runtime.ContentTypeJSON}, ",")
+	restConfig.QPS = s.qps
+	restConfig.Burst = s.burst
+	mapper, err := apiutil.NewDynamicRESTMapper(restConfig, apiutil.WithLazyDiscovery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create REST mapper for cluster %s: %w", cluster.Name, err)
+	}
+	remoteClient, err = client.New(restConfig, client.Options{Scheme: s.client.Scheme(), Mapper: mapper})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client for cluster %s: %w", cluster.Name, err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// Keep the client another reconciliation stored meanwhile, if any, so
+	// that the machines of the cluster share a single rate limit.
+	if existing, ok := s.clients[cluster.UID]; ok {
+		return existing, nil
+	}
+	if s.clients == nil {
+		s.clients = map[types.UID]client.Client{}
+	}
+	s.clients[cluster.UID] = remoteClient
+	return remoteClient, nil
+}
+
+// forgetClient drops the client of a cluster after it was refused, e.g.
+// because the admin kubeconfig was rotated, so the next request rebuilds it.
+func (s *workloadClusterResources) forgetClient(cluster *clusterv1.Cluster, err error) error {
+	if apierrors.IsUnauthorized(err) || apierrors.IsForbidden(err) {
+		s.forgetCluster(cluster.UID)
+	}
+	return err
+}
+
+// forgetCluster drops the client of a cluster.
+func (s *workloadClusterResources) forgetCluster(uid types.UID) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.clients, uid)
+}
+
+func (s *workloadClusterResources) ApplyNode(ctx context.Context, cluster *clusterv1.Cluster, node *v1.Node) error {
+	remoteClient, err := s.remoteClient(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	return s.forgetClient(cluster, remoteClient.Patch(ctx, node, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership))
+}
+
+func (s *workloadClusterResources) PatchNodeConditions(ctx context.Context, cluster *clusterv1.Cluster, nodeName string, nodeConditions []v1.NodeCondition) error {
+	remoteClient, err := s.remoteClient(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	patch, err := nodeConditionsPatch(nodeConditions)
+	if err != nil {
+		return err
+	}
+	return s.forgetClient(cluster, remoteClient.Status().Patch(ctx, &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: nodeName,
+		},
+	}, patch, client.FieldOwner(fieldManager)))
+}
+
+func (s *workloadClusterResources) PatchNodeAllocatable(ctx context.Context, cluster *clusterv1.Cluster, nodeName string, allocatable v1.ResourceList) error {
+	remoteClient, err := s.remoteClient(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"allocatable": allocatable,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return s.forgetClient(cluster, remoteClient.Status().Patch(ctx, &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: nodeName,
+		},
+	}, client.RawPatch(types.StrategicMergePatchType, patch), client.FieldOwner(fieldManager)))
+}
+
+// nodeConditionsPatch returns a patch of the status of a Node setting the
+// given conditions. Only the fields that are set are patched, conditions are
+// merged by type like the kubelet does, and unset transition times are kept.
+func nodeConditionsPatch(nodeConditions []v1.NodeCondition) (client.Patch, error) {
+	patchConditions := make([]map[string]interface{}, 0, len(nodeConditions))
+	for _, condition := range nodeConditions {
+		patchCondition := map[string]interface{}{
+			"type":              condition.Type,
+			"status":            condition.Status,
+			"reason":            condition.Reason,
+			"message":           condition.Message,
+			"lastHeartbeatTime": condition.LastHeartbeatTime,
+		}
+		if !condition.LastTransitionTime.IsZero() {
+			patchCondition["lastTransitionTime"] = condition.LastTransitionTime
+		}
+		patchConditions = append(patchConditions, patchCondition)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": patchConditions,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return client.RawPatch(types.StrategicMergePatchType, patch), nil
+}
+
+func (s *workloadClusterResources) ApplyNodeLease(ctx context.Context, cluster *clusterv1.Cluster, lease *coordinationv1.Lease) error {
+	remoteClient, err := s.remoteClient(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	return s.forgetClient(cluster, remoteClient.Patch(ctx, lease, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership))
+}
+
+func (s *workloadClusterResources) DeleteNode(ctx context.Context, cluster *clusterv1.Cluster, nodeName string) error {
+	remoteClient, err := s.remoteClient(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	if err := remoteClient.Delete(ctx, &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: nodeName,
+		},
+	}); err != nil && !apierrors.IsNotFound(err) {
+		return s.forgetClient(cluster, err)
+	}
+	// The leases of a kubelet are owned by their Node and garbage collected
+	// with it, those renewed by the controller are not.
+	if err := remoteClient.Delete(ctx, &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nodeName,
+			Namespace: v1.NamespaceNodeLease,
+		},
+	}); err != nil && !apierrors.IsNotFound(err) {
+		return s.forgetClient(cluster, err)
+	}
+	return nil
+}
+
+func (s *workloadClusterResources) ApplyClusterRoleBinding(ctx context.Context, cluster *clusterv1.Cluster, binding *rbacv1.ClusterRoleBinding) error {
+	remoteClient, err := s.remoteClient(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	return s.forgetClient(cluster, remoteClient.Patch(ctx, binding, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership))
+}
+
+// conditionsStatus records the state of a KubemarkMachine in its status and
+// InstanceReady condition.
+type conditionsStatus struct{}
+
+func (conditionsStatus) SetWaiting(kubemarkMachine *infrav1.KubemarkMachine, reason string) {
+	conditions.MarkFalse(kubemarkMachine, infrav1.InstanceReadyCondition, reason, clusterv1.ConditionSeverityInfo, "")
+}
+
+func (conditionsStatus) SetReady(kubemarkMachine *infrav1.KubemarkMachine, providerID string) {
+	kubemarkMachine.Spec.ProviderID = pointer.StringPtr(providerID)
+	if kubemarkMachine.Status.ProvisioningDuration == nil {
+		kubemarkMachine.Status.ProvisioningDuration = &metav1.Duration{
+			Duration: time.Since(kubemarkMachine.CreationTimestamp.Time).Round(time.Second),
+		}
+	}
+	conditions.MarkTrue(kubemarkMachine, infrav1.InstanceReadyCondition)
+	kubemarkMachine.Status.Ready = true
+}
+
+func (conditionsStatus) SetStopped(kubemarkMachine *infrav1.KubemarkMachine) {
+	conditions.MarkFalse(kubemarkMachine, infrav1.InstanceReadyCondition, infrav1.InstanceStoppedReason, clusterv1.ConditionSeverityWarning, "")
+	kubemarkMachine.Status.Ready = false
+}
+
+func (conditionsStatus) SetTerminated(kubemarkMachine *infrav1.KubemarkMachine, message string) {
+	reason := capierrors.UpdateMachineError
+	kubemarkMachine.Status.FailureReason = &reason
+	kubemarkMachine.Status.FailureMessage = pointer.StringPtr(message)
+	conditions.MarkFalse(kubemarkMachine, infrav1.InstanceReadyCondition, infrav1.InstanceTerminatedReason, clusterv1.ConditionSeverityError, message)
+	kubemarkMachine.Status.Ready = false
+}
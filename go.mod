@@ -3,7 +3,8 @@ module github.com/benmoss/cluster-api-provider-kubemark
 go 1.15
 
 require (
-	github.com/go-logr/logr v0.2.1
+	github.com/go-logr/logr v0.2.1 // indirect
+	github.com/prometheus/client_golang v1.7.1
 	k8s.io/api v0.19.2
 	k8s.io/apimachinery v0.19.2
 	k8s.io/client-go v0.19.2
@@ -18,15 +18,24 @@ package main
 
 import (
 	"flag"
+	"net"
 	"os"
+	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 	"k8s.io/klog/v2/klogr"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
-	bootstrapv1 "sigs.k8s.io/cluster-api/bootstrap/kubeadm/api/v1alpha4"
+	"sigs.k8s.io/cluster-api/controllers/remote"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	infrastructurev1alpha4 "github.com/benmoss/cluster-api-provider-kubemark/api/v1alpha4"
 	"github.com/benmoss/cluster-api-provider-kubemark/controllers"
@@ -44,16 +53,76 @@ func init() {
 
 	_ = infrastructurev1alpha4.AddToScheme(scheme)
 	_ = clusterv1.AddToScheme(scheme)
-	_ = bootstrapv1.AddToScheme(scheme)
 	// +kubebuilder:scaffold:scheme
 }
 
 func main() {
-	var metricsAddr string
+	var configFile string
+	var metricsAddr, pprofAddr string
+	var enablePprof bool
 	var enableLeaderElection bool
-	var kubemarkImage string
+	var kubemarkImage, versionImages string
+	var skipCRDCheck bool
+	var webhookPort int
+	var watchNamespace string
+	var requeueBaseDelay, requeueMaxDelay, reconcileTimeout, shutdownTimeout time.Duration
+	var clusterProbeInterval, clusterProbeTimeout time.Duration
+	var maxProvisionsPerSecond float64
+	var provisionBurst, concurrency int
+	var kubeAPIQPS, remoteKubeAPIQPS float64
+	var kubeAPIBurst, remoteKubeAPIBurst int
+	var kubeletStubPort int
+	var kubeletStubAddress string
+	var kubeletKeyAlgorithm string
+	flag.StringVar(&configFile, "config", "",
+		"A KubemarkControllerConfiguration file setting any of the other flags by name. Flags set on the command line take precedence.")
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
-	flag.StringVar(&kubemarkImage, "kubemark-image", "gcr.io/cf-london-servces-k8s/bmo/kubemark", "The location of the kubemark image")
+	flag.BoolVar(&enablePprof, "enable-pprof", false, "Serve the net/http/pprof profiles on --pprof-bind-address.")
+	flag.StringVar(&pprofAddr, "pprof-bind-address", "localhost:6060", "The address the pprof endpoint binds to.")
+	defaultKubemarkImage := "gcr.io/cf-london-servces-k8s/bmo/kubemark"
+	if image := os.Getenv("KUBEMARK_IMAGE"); image != "" {
+		defaultKubemarkImage = image
+	}
+	flag.StringVar(&kubemarkImage, "kubemark-image", defaultKubemarkImage, "The location of the kubemark image, tagged with the Kubernetes version of each machine. Defaults to $KUBEMARK_IMAGE if set.")
+	flag.StringVar(&versionImages, "version-images", "",
+		"The <namespace>/<name> of a ConfigMap mapping Kubernetes versions, such as v1.19.1 or v1.19, to the kubemark image run by machines of that version.")
+	flag.BoolVar(&skipCRDCheck, "skip-crd-check", false, "Start even if the installed CRDs do not match this controller.")
+	flag.DurationVar(&requeueBaseDelay, "requeue-base-delay", 5*time.Millisecond,
+		"The delay before retrying a failed reconciliation. It doubles with every consecutive failure of the same object.")
+	flag.DurationVar(&requeueMaxDelay, "requeue-max-delay", 1000*time.Second,
+		"The maximum delay before retrying a failed reconciliation.")
+	flag.DurationVar(&reconcileTimeout, "reconcile-timeout", 0,
+		"The maximum duration of a reconciliation of the controllers reaching workload clusters, after which it fails and is retried. Set to 0 to leave reconciliations unbounded.")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second,
+		"How long the manager waits on shutdown for the reconciliations in flight to finish before cancelling them.")
+	flag.DurationVar(&clusterProbeInterval, "cluster-probe-interval", 30*time.Second,
+		"How often the API server of each workload cluster is probed. The machines of unreachable clusters back off without trying to reach them. Set to 0 to disable probing.")
+	flag.DurationVar(&clusterProbeTimeout, "cluster-probe-timeout", 5*time.Second,
+		"The maximum duration of a probe of a workload cluster.")
+	flag.IntVar(&concurrency, "concurrency", 1,
+		"The number of objects each controller reconciles at once.")
+	flag.Float64Var(&maxProvisionsPerSecond, "max-provisions-per-second", 0,
+		"The maximum rate at which new hollow nodes are provisioned. Set to 0 to provision machines as fast as they are created.")
+	flag.IntVar(&provisionBurst, "provision-burst", 10,
+		"The number of hollow nodes that may be provisioned at once before --max-provisions-per-second applies.")
+	flag.Float64Var(&kubeAPIQPS, "kube-api-qps", 20,
+		"The maximum queries per second from the manager to the management cluster API server.")
+	flag.IntVar(&kubeAPIBurst, "kube-api-burst", 30,
+		"The maximum burst of queries from the manager to the management cluster API server.")
+	flag.Float64Var(&remoteKubeAPIQPS, "remote-kube-api-qps", 20,
+		"The maximum queries per second from the manager to the API server of each workload cluster.")
+	flag.IntVar(&remoteKubeAPIBurst, "remote-kube-api-burst", 30,
+		"The maximum burst of queries from the manager to the API server of each workload cluster.")
+	flag.IntVar(&kubeletStubPort, "kubelet-stub-port", 0,
+		"The port of a stub kubelet API answering kubectl logs and exec for the Nodes of the node backend. Set to 0 to disable it.")
+	flag.StringVar(&kubeletStubAddress, "kubelet-stub-address", os.Getenv("POD_IP"),
+		"The IP the Nodes of the node backend register to reach the stub kubelet API. Defaults to $POD_IP if set.")
+	flag.StringVar(&kubeletKeyAlgorithm, "kubelet-key-algorithm", string(controllers.KubeletKeyECDSAP256),
+		"The algorithm of the keys of the kubelet certificates signed with the cluster CA: ECDSA-P256, ECDSA-P384, RSA-2048, RSA-3072 or RSA-4096.")
+	flag.IntVar(&webhookPort, "webhook-port", 9443,
+		"The port the admission webhook server binds to. Set to 0 to disable the webhooks, e.g. when running outside the cluster.")
+	flag.StringVar(&watchNamespace, "watch-namespace", "",
+		"A comma-separated list of namespaces the controller watches for Kubemark machines. If unspecified, all namespaces are watched.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
@@ -61,31 +130,195 @@ func main() {
 
 	ctrl.SetLogger(klogr.New())
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	if configFile != "" {
+		if err := loadConfigFile(flag.CommandLine, configFile); err != nil {
+			setupLog.Error(err, "unable to load configuration file")
+			os.Exit(1)
+		}
+	}
+
+	options := ctrl.Options{
 		Scheme:             scheme,
 		MetricsBindAddress: metricsAddr,
-		Port:               9443,
+		Port:               webhookPort,
 		LeaderElection:     enableLeaderElection,
 		LeaderElectionID:   "c9a96920.cluster.x-k8s.io",
-	})
+	}
+	if namespaces := strings.Split(watchNamespace, ","); len(namespaces) > 1 {
+		setupLog.Info("watching objects in namespaces", "namespaces", namespaces)
+		options.NewCache = multiNamespaceCacheBuilder(namespaces)
+	} else if watchNamespace != "" {
+		setupLog.Info("watching objects in namespace", "namespace", watchNamespace)
+		options.Namespace = watchNamespace
+	}
+	restConfig := ctrl.GetConfigOrDie()
+	restConfig.QPS = float32(kubeAPIQPS)
+	restConfig.Burst = kubeAPIBurst
+	mgr, err := ctrl.NewManager(restConfig, options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 	ctx := ctrl.SetupSignalHandler()
+	// Each controller gets its own rate limiter, they track failures per
+	// object name and the controllers share object names.
+	controllerOptions := func() controller.Options {
+		return controller.Options{
+			MaxConcurrentReconciles: concurrency,
+			RateLimiter:             workqueue.NewItemExponentialFailureRateLimiter(requeueBaseDelay, requeueMaxDelay),
+		}
+	}
+	var versionImagesKey *types.NamespacedName
+	if versionImages != "" {
+		namespace, name, err := cache.SplitMetaNamespaceKey(versionImages)
+		if err != nil || namespace == "" {
+			setupLog.Error(err, "--version-images must be of the form <namespace>/<name>")
+			os.Exit(1)
+		}
+		versionImagesKey = &types.NamespacedName{Namespace: namespace, Name: name}
+	}
+	var provisions flowcontrol.RateLimiter
+	if maxProvisionsPerSecond > 0 {
+		provisions = flowcontrol.NewTokenBucketRateLimiter(float32(maxProvisionsPerSecond), provisionBurst)
+	}
+	if !skipCRDCheck {
+		if err := controllers.CheckCRDs(ctx, mgr.GetAPIReader()); err != nil {
+			setupLog.Error(err, "installed CRDs are not compatible with this controller")
+			os.Exit(1)
+		}
+	}
+	if err := controllers.IndexKubemarkMachines(ctx, mgr.GetFieldIndexer()); err != nil {
+		setupLog.Error(err, "unable to index kubemark machines")
+		os.Exit(1)
+	}
+	supportedKeyAlgorithm := false
+	for _, algorithm := range controllers.KubeletKeyAlgorithms {
+		supportedKeyAlgorithm = supportedKeyAlgorithm || string(algorithm) == kubeletKeyAlgorithm
+	}
+	if !supportedKeyAlgorithm {
+		setupLog.Error(nil, "unsupported --kubelet-key-algorithm", "algorithm", kubeletKeyAlgorithm)
+		os.Exit(1)
+	}
+	if enablePprof {
+		if err := mgr.Add(&pprofServer{addr: pprofAddr}); err != nil {
+			setupLog.Error(err, "unable to add pprof server")
+			os.Exit(1)
+		}
+	}
+	var kubeletStub *controllers.KubeletStub
+	if kubeletStubPort != 0 {
+		if net.ParseIP(kubeletStubAddress) == nil {
+			setupLog.Error(nil, "--kubelet-stub-address must be an IP when --kubelet-stub-port is set", "address", kubeletStubAddress)
+			os.Exit(1)
+		}
+		kubeletStub = &controllers.KubeletStub{
+			Address: kubeletStubAddress,
+			Port:    int32(kubeletStubPort),
+		}
+		if err := mgr.Add(kubeletStub); err != nil {
+			setupLog.Error(err, "unable to add kubelet stub")
+			os.Exit(1)
+		}
+	}
+	var prober *controllers.ClusterProber
+	if clusterProbeInterval != 0 {
+		prober = &controllers.ClusterProber{
+			Client:   mgr.GetClient(),
+			Interval: clusterProbeInterval,
+			Timeout:  clusterProbeTimeout,
+		}
+		if err := mgr.Add(prober); err != nil {
+			setupLog.Error(err, "unable to add cluster prober")
+			os.Exit(1)
+		}
+	}
+	// The manager stops handing out reconciliations on SIGTERM, those in
+	// flight are drained once it returns.
+	drainer := controllers.NewDrainer()
 	if err = (&controllers.KubemarkMachineReconciler{
-		Client:        mgr.GetClient(),
-		Log:           ctrl.Log.WithName("controllers").WithName("KubemarkMachine"),
-		Scheme:        mgr.GetScheme(),
-		KubemarkImage: kubemarkImage,
-	}).SetupWithManager(ctx, mgr); err != nil {
+		Client:              mgr.GetClient(),
+		Scheme:              mgr.GetScheme(),
+		KubemarkImage:       kubemarkImage,
+		VersionImages:       versionImagesKey,
+		Provisions:          provisions,
+		RemoteQPS:           float32(remoteKubeAPIQPS),
+		RemoteBurst:         remoteKubeAPIBurst,
+		KubeletStub:         kubeletStub,
+		KubeletKeyAlgorithm: controllers.KubeletKeyAlgorithm(kubeletKeyAlgorithm),
+		ReconcileTimeout:    reconcileTimeout,
+		Drainer:             drainer,
+		Prober:              prober,
+	}).SetupWithManager(ctx, mgr, controllerOptions()); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "KubemarkMachine")
 		os.Exit(1)
 	}
+	if err = (&controllers.KubemarkMachineTemplateReconciler{
+		Client:  mgr.GetClient(),
+		Scheme:  mgr.GetScheme(),
+		Drainer: drainer,
+	}).SetupWithManager(ctx, mgr, controllerOptions()); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "KubemarkMachineTemplate")
+		os.Exit(1)
+	}
+	if err = (&controllers.KubemarkChaosCampaignReconciler{
+		Client:  mgr.GetClient(),
+		Drainer: drainer,
+	}).SetupWithManager(ctx, mgr, controllerOptions()); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "KubemarkChaosCampaign")
+		os.Exit(1)
+	}
+	tracker, err := remote.NewClusterCacheTracker(ctrl.Log.WithName("remote").WithName("ClusterCacheTracker"), mgr)
+	if err != nil {
+		setupLog.Error(err, "unable to create cluster cache tracker")
+		os.Exit(1)
+	}
+	if err = (&remote.ClusterCacheReconciler{
+		Client:  mgr.GetClient(),
+		Log:     ctrl.Log.WithName("remote").WithName("ClusterCacheReconciler"),
+		Tracker: tracker,
+	}).SetupWithManager(ctx, mgr, controller.Options{}); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterCacheReconciler")
+		os.Exit(1)
+	}
+	if err = (&controllers.KubemarkWorkloadReconciler{
+		Client:           mgr.GetClient(),
+		Tracker:          tracker,
+		ReconcileTimeout: reconcileTimeout,
+		Drainer:          drainer,
+	}).SetupWithManager(ctx, mgr, controllerOptions()); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "KubemarkWorkload")
+		os.Exit(1)
+	}
+	if err = (&controllers.KubemarkNodeReconciler{
+		Client:           mgr.GetClient(),
+		Tracker:          tracker,
+		ReconcileTimeout: reconcileTimeout,
+		Drainer:          drainer,
+		Prober:           prober,
+	}).SetupWithManager(ctx, mgr, controllerOptions()); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "KubemarkNode")
+		os.Exit(1)
+	}
+	if webhookPort != 0 {
+		if err = (&infrastructurev1alpha4.KubemarkMachine{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "KubemarkMachine")
+			os.Exit(1)
+		}
+		if err = (&infrastructurev1alpha4.KubemarkMachineTemplate{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "KubemarkMachineTemplate")
+			os.Exit(1)
+		}
+	}
+	metrics.Registry.MustRegister(controllers.NewFleetCollector(mgr.GetClient()))
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctx); err != nil {
+	err = mgr.Start(ctx)
+	setupLog.Info("draining reconciliations in flight", "timeout", shutdownTimeout)
+	if !drainer.Drain(shutdownTimeout) {
+		setupLog.Info("cancelled reconciliations still in flight after the shutdown timeout")
+	}
+	if err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
@@ -0,0 +1,62 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/pprof"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// pprofServer serves the net/http/pprof profiles, so that CPU and heap
+// profiles can be taken while large fleets are provisioned.
+type pprofServer struct {
+	addr string
+}
+
+// Start serves the profiles until the context is done.
+func (s *pprofServer) Start(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	server := &http.Server{
+		Addr:    s.addr,
+		Handler: mux,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		ctrl.Log.WithName("pprof").Info("serving profiles", "address", s.addr)
+		errs <- server.ListenAndServe()
+	}()
+	select {
+	case <-ctx.Done():
+		return server.Close()
+	case err := <-errs:
+		return err
+	}
+}
+
+// NeedLeaderElection is false, every replica of the manager can be profiled.
+func (s *pprofServer) NeedLeaderElection() bool {
+	return false
+}